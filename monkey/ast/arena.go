@@ -0,0 +1,146 @@
+package ast
+
+// arenaChunkSize is the number of nodes of one type allocated at a time.
+const arenaChunkSize = 128
+
+// slab hands out pointers into fixed-size chunks of T. Chunks are never
+// grown in place, so pointers stay valid until the owning Arena is reset.
+type slab[T any] struct {
+	chunk []T
+}
+
+func (s *slab[T]) alloc(v T) *T {
+	if len(s.chunk) == cap(s.chunk) {
+		s.chunk = make([]T, 0, arenaChunkSize)
+	}
+	s.chunk = append(s.chunk, v)
+	return &s.chunk[len(s.chunk)-1]
+}
+
+// heapNode copies v into its own allocation. Taking &v directly would make
+// every arena call site move its argument to the heap.
+func heapNode[T any](v T) *T {
+	n := new(T)
+	*n = v
+	return n
+}
+
+// Arena allocates AST nodes in chunks instead of one by one. Nodes from an
+// arena are released together once neither the arena nor any node is
+// referenced. A nil *Arena is valid and falls back to ordinary allocation.
+type Arena struct {
+	lets        slab[LetStatement]
+	returns     slab[ReturnStatement]
+	exprStmts   slab[ExpressionStatement]
+	blocks      slab[BlockStatement]
+	identifiers slab[Identifier]
+	integers    slab[IntegerLiteral]
+	booleans    slab[Boolean]
+	prefixes    slab[PrefixExpression]
+	infixes     slab[InfixExpression]
+	ifs         slab[IfExpression]
+	functions   slab[FunctionLiteral]
+	calls       slab[CallExpression]
+	tuples      slab[TupleLiteral]
+}
+
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Reset drops the arena's references to its chunks so that nodes handed out
+// so far can be collected. Later allocations start fresh chunks.
+func (a *Arena) Reset() {
+	*a = Arena{}
+}
+
+func (a *Arena) LetStatement(v LetStatement) *LetStatement {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.lets.alloc(v)
+}
+
+func (a *Arena) ReturnStatement(v ReturnStatement) *ReturnStatement {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.returns.alloc(v)
+}
+
+func (a *Arena) ExpressionStatement(v ExpressionStatement) *ExpressionStatement {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.exprStmts.alloc(v)
+}
+
+func (a *Arena) BlockStatement(v BlockStatement) *BlockStatement {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.blocks.alloc(v)
+}
+
+func (a *Arena) Identifier(v Identifier) *Identifier {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.identifiers.alloc(v)
+}
+
+func (a *Arena) IntegerLiteral(v IntegerLiteral) *IntegerLiteral {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.integers.alloc(v)
+}
+
+func (a *Arena) Boolean(v Boolean) *Boolean {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.booleans.alloc(v)
+}
+
+func (a *Arena) PrefixExpression(v PrefixExpression) *PrefixExpression {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.prefixes.alloc(v)
+}
+
+func (a *Arena) InfixExpression(v InfixExpression) *InfixExpression {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.infixes.alloc(v)
+}
+
+func (a *Arena) IfExpression(v IfExpression) *IfExpression {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.ifs.alloc(v)
+}
+
+func (a *Arena) FunctionLiteral(v FunctionLiteral) *FunctionLiteral {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.functions.alloc(v)
+}
+
+func (a *Arena) CallExpression(v CallExpression) *CallExpression {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.calls.alloc(v)
+}
+
+func (a *Arena) TupleLiteral(v TupleLiteral) *TupleLiteral {
+	if a == nil {
+		return heapNode(v)
+	}
+	return a.tuples.alloc(v)
+}
@@ -1,9 +1,13 @@
+// Package ast defines the syntax tree the parser produces. The node types
+// change along with the grammar; programs embedding Monkey should go
+// through package monkey instead.
 package ast
 
 import (
 	"bytes"
 	"monkey/token"
 	"strings"
+	"sync/atomic"
 )
 
 type Node interface {
@@ -46,7 +50,9 @@ func (p *Program) String() string {
 type LetStatement struct {
 	Token token.Token // token.LET
 	Name  *Identifier
+	Names []*Identifier // set instead of Name for `let (a, b) = ...`
 	Value Expression
+	Else  *BlockStatement // run instead of binding a null Value, if set
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -56,12 +62,23 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Names != nil {
+		names := []string{}
+		for _, name := range ls.Names {
+			names = append(names, name.String())
+		}
+		out.WriteString("(" + strings.Join(names, ", ") + ")")
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
 	}
+	if ls.Else != nil {
+		out.WriteString(" else " + ls.Else.String())
+	}
 	out.WriteString(";")
 
 	return out.String()
@@ -103,6 +120,14 @@ func (es *ExpressionStatement) String() string {
 type Identifier struct {
 	Token token.Token // token.IDENT
 	Value string
+
+	// Unbound is set by MarkUnbound if no let statement or parameter of
+	// the program binds Value.
+	Unbound bool
+
+	// Cache is the evaluator's memo of what an Unbound identifier resolves
+	// to, shared by every evaluation of the node.
+	Cache atomic.Value
 }
 
 func (i *Identifier) expressionNode()      {}
@@ -211,6 +236,7 @@ type FunctionLiteral struct {
 	Token      token.Token // token.FUNCTION
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Captures   []string // see FreeVariables; nil if not computed
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -255,3 +281,20 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// TupleLiteral groups several values, as in `return a, b;`.
+type TupleLiteral struct {
+	Token    token.Token // the first token of the first element
+	Elements []Expression
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) String() string {
+	elements := []string{}
+	for _, el := range tl.Elements {
+		elements = append(elements, el.String())
+	}
+
+	return strings.Join(elements, ", ")
+}
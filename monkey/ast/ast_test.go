@@ -26,3 +26,38 @@ func TestString(t *testing.T) {
 		t.Errorf("prgoram.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestMarkUnbound(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	// let f = fn(x) { x + g }; f
+	f, x, g, fRef, xRef := ident("f"), ident("x"), ident("g"), ident("f"), ident("x")
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  f,
+				Value: &FunctionLiteral{
+					Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+					Parameters: []*Identifier{x},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{Left: xRef, Operator: "+", Right: g}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: fRef},
+		},
+	}
+
+	MarkUnbound(program)
+
+	for _, id := range []*Identifier{f, x, fRef, xRef} {
+		if id.Unbound {
+			t.Errorf("%s is bound in the program but marked unbound", id.Value)
+		}
+	}
+	if !g.Unbound {
+		t.Errorf("g is not bound in the program but not marked unbound")
+	}
+}
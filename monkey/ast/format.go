@@ -0,0 +1,160 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Format pretty-prints node as Monkey source that parses back into the same
+// tree. Unlike String, which is meant for debugging, it terminates every
+// statement, keeps the braces of blocks and indents them by two spaces.
+// Operands that are themselves operator expressions are parenthesized, so
+// the output does not depend on operator precedence.
+func Format(node Node) string {
+	f := &formatter{}
+	f.node(node)
+	return f.out.String()
+}
+
+type formatter struct {
+	out    bytes.Buffer
+	indent int
+}
+
+func (f *formatter) node(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			f.statement(s)
+			f.out.WriteString("\n")
+		}
+	case Statement:
+		f.statement(n)
+	case Expression:
+		f.expression(n)
+	}
+}
+
+func (f *formatter) statement(stmt Statement) {
+	switch s := stmt.(type) {
+	case *LetStatement:
+		f.out.WriteString("let ")
+		if s.Names != nil {
+			names := []string{}
+			for _, name := range s.Names {
+				names = append(names, name.Value)
+			}
+			f.out.WriteString("(" + strings.Join(names, ", ") + ")")
+		} else {
+			f.out.WriteString(s.Name.Value)
+		}
+		f.out.WriteString(" = ")
+		f.expression(s.Value)
+		if s.Else != nil {
+			f.out.WriteString(" else ")
+			f.block(s.Else)
+		}
+		f.out.WriteString(";")
+	case *ReturnStatement:
+		f.out.WriteString("return ")
+		f.expression(s.ReturnValue)
+		f.out.WriteString(";")
+	case *ExpressionStatement:
+		f.expression(s.Expression)
+		f.out.WriteString(";")
+	case *BlockStatement:
+		f.block(s)
+	}
+}
+
+func (f *formatter) block(bs *BlockStatement) {
+	if len(bs.Statements) == 0 {
+		f.out.WriteString("{}")
+		return
+	}
+
+	f.out.WriteString("{\n")
+	f.indent++
+	for _, s := range bs.Statements {
+		f.out.WriteString(strings.Repeat("  ", f.indent))
+		f.statement(s)
+		f.out.WriteString("\n")
+	}
+	f.indent--
+	f.out.WriteString(strings.Repeat("  ", f.indent) + "}")
+}
+
+func (f *formatter) expression(expr Expression) {
+	switch e := expr.(type) {
+	case *Identifier:
+		f.out.WriteString(e.Value)
+	case *IntegerLiteral, *Boolean:
+		f.out.WriteString(e.TokenLiteral())
+	case *PrefixExpression:
+		f.out.WriteString(e.Operator)
+		f.operand(e.Right)
+	case *InfixExpression:
+		f.operand(e.Left)
+		f.out.WriteString(" " + e.Operator + " ")
+		f.operand(e.Right)
+	case *IfExpression:
+		f.out.WriteString("if (")
+		f.expression(e.Condition)
+		f.out.WriteString(") ")
+		f.block(e.Consequence)
+		if e.Alternative != nil {
+			f.out.WriteString(" else ")
+			f.block(e.Alternative)
+		}
+	case *FunctionLiteral:
+		params := []string{}
+		for _, param := range e.Parameters {
+			params = append(params, param.Value)
+		}
+		f.out.WriteString("fn(" + strings.Join(params, ", ") + ") ")
+		f.block(e.Body)
+	case *CallExpression:
+		switch e.Function.(type) {
+		case *Identifier, *CallExpression:
+			f.expression(e.Function)
+		default:
+			f.parenthesized(e.Function)
+		}
+		f.list(e.Arguments)
+	case *TupleLiteral:
+		for i, el := range e.Elements {
+			if i > 0 {
+				f.out.WriteString(", ")
+			}
+			f.expression(el)
+		}
+	}
+}
+
+// operand writes the operand of a prefix or infix operator, parenthesizing
+// nested operator expressions.
+func (f *formatter) operand(expr Expression) {
+	switch expr.(type) {
+	case *PrefixExpression, *InfixExpression:
+		f.parenthesized(expr)
+	default:
+		f.expression(expr)
+	}
+}
+
+func (f *formatter) parenthesized(expr Expression) {
+	f.out.WriteString("(")
+	f.expression(expr)
+	f.out.WriteString(")")
+}
+
+func (f *formatter) list(exprs []Expression) {
+	f.out.WriteString("(")
+	for i, expr := range exprs {
+		if i > 0 {
+			f.out.WriteString(", ")
+		}
+		f.expression(expr)
+	}
+	f.out.WriteString(")")
+}
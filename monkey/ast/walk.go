@@ -0,0 +1,167 @@
+package ast
+
+import (
+	"monkey/token"
+	"reflect"
+	"sort"
+)
+
+// Walk traverses the tree rooted at node in source order. It calls fn for
+// every node and only descends into a node's children if fn returns true.
+// Missing children, such as the Alternative of an if without else, are
+// skipped.
+func Walk(node Node, fn func(Node) bool) {
+	if isNil(node) || !fn(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Walk(s, fn)
+		}
+	case *LetStatement:
+		Walk(n.Name, fn)
+		for _, name := range n.Names {
+			Walk(name, fn)
+		}
+		Walk(n.Value, fn)
+		Walk(n.Else, fn)
+	case *ReturnStatement:
+		Walk(n.ReturnValue, fn)
+	case *ExpressionStatement:
+		Walk(n.Expression, fn)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Walk(s, fn)
+		}
+	case *PrefixExpression:
+		Walk(n.Right, fn)
+	case *InfixExpression:
+		Walk(n.Left, fn)
+		Walk(n.Right, fn)
+	case *IfExpression:
+		Walk(n.Condition, fn)
+		Walk(n.Consequence, fn)
+		Walk(n.Alternative, fn)
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			Walk(p, fn)
+		}
+		Walk(n.Body, fn)
+	case *CallExpression:
+		Walk(n.Function, fn)
+		for _, a := range n.Arguments {
+			Walk(a, fn)
+		}
+	case *TupleLiteral:
+		for _, el := range n.Elements {
+			Walk(el, fn)
+		}
+	}
+}
+
+// FreeVariables returns, sorted, the names the body of fl may look up in
+// the environment fl is evaluated in: every identifier it mentions,
+// including inside nested functions, except fl's own parameters. Names
+// that are in fact bound by a let in the body are included too, which
+// keeps the result conservative.
+func FreeVariables(fl *FunctionLiteral) []string {
+	params := map[string]bool{}
+	for _, p := range fl.Parameters {
+		params[p.Value] = true
+	}
+
+	seen := map[string]bool{}
+	names := []string{}
+	Walk(fl.Body, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok && !params[ident.Value] && !seen[ident.Value] {
+			seen[ident.Value] = true
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+
+	sort.Strings(names)
+	return names
+}
+
+// MarkUnbound sets Unbound on every identifier of program whose name no
+// let statement or function parameter in program binds. Calls bind only
+// such names, so an unbound identifier can only resolve to a binding of
+// the environment program is evaluated in, or to a builtin.
+func MarkUnbound(program *Program) {
+	bound := map[string]bool{}
+	Walk(program, func(n Node) bool {
+		switch n := n.(type) {
+		case *LetStatement:
+			if n.Name != nil {
+				bound[n.Name.Value] = true
+			}
+			for _, name := range n.Names {
+				bound[name.Value] = true
+			}
+		case *FunctionLiteral:
+			for _, p := range n.Parameters {
+				bound[p.Value] = true
+			}
+		}
+		return true
+	})
+
+	Walk(program, func(n Node) bool {
+		if ident, ok := n.(*Identifier); ok {
+			ident.Unbound = !bound[ident.Value]
+		}
+		return true
+	})
+}
+
+// isNil reports whether node is nil or a typed nil pointer, which is what
+// the parser leaves behind for optional or failed children.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// TokenOf returns the token node was built from, or nil for a Program or a
+// nil node. The pointer refers to the node itself, so the token can be
+// updated in place.
+func TokenOf(node Node) *token.Token {
+	if isNil(node) {
+		return nil
+	}
+
+	switch n := node.(type) {
+	case *LetStatement:
+		return &n.Token
+	case *ReturnStatement:
+		return &n.Token
+	case *ExpressionStatement:
+		return &n.Token
+	case *BlockStatement:
+		return &n.Token
+	case *Identifier:
+		return &n.Token
+	case *IntegerLiteral:
+		return &n.Token
+	case *Boolean:
+		return &n.Token
+	case *PrefixExpression:
+		return &n.Token
+	case *InfixExpression:
+		return &n.Token
+	case *IfExpression:
+		return &n.Token
+	case *FunctionLiteral:
+		return &n.Token
+	case *CallExpression:
+		return &n.Token
+	case *TupleLiteral:
+		return &n.Token
+	}
+	return nil
+}
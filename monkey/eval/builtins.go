@@ -0,0 +1,201 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"monkey/object"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// builtins holds the functions available in every environment. It is
+// filled in init because builtins call back into the evaluator, which in
+// turn looks identifiers up here.
+var builtins map[string]*object.Builtin
+
+func init() {
+	builtins = map[string]*object.Builtin{
+		"compose": {
+			Name:      "compose",
+			Fn:        builtinCompose,
+			Signature: "compose(f, g, ...)",
+			Doc:       "Returns a function applying the given functions from right to left: compose(f, g)(x) is f(g(x)).",
+		},
+		"partial": {
+			Name:      "partial",
+			Fn:        builtinPartial,
+			Signature: "partial(f, args...)",
+			Doc:       "Returns a function calling f with args followed by its own arguments.",
+		},
+		"memoize": {
+			Name:      "memoize",
+			Fn:        builtinMemoize,
+			Signature: "memoize(f)",
+			Doc:       "Returns a function calling f and caching its result for each combination of hashable arguments.",
+		},
+		"with_timeout": {
+			Name:      "with_timeout",
+			Fn:        builtinWithTimeout,
+			Signature: "with_timeout(ms, f)",
+			Doc:       "Calls f without arguments and returns its result, or an error if it runs longer than ms milliseconds.",
+		},
+	}
+}
+
+// LookupBuiltin returns the builtin called name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	b, ok := builtins[name]
+	return b, ok
+}
+
+// BuiltinNames returns the names of all builtins in alphabetical order.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compose(f, g, ...) returns a function that applies the given functions
+// from right to left: compose(f, g)(x) is f(g(x)). The rightmost function
+// receives all arguments; every other one receives the previous result.
+func builtinCompose(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to `compose`. got=0, want at least 1")
+	}
+	for i, arg := range args {
+		if !isCallable(arg) {
+			return newError("argument %d to `compose` must be a function, got %s", i+1, arg.Type())
+		}
+	}
+
+	fns := append([]object.Object{}, args...)
+	composed := func(ctx context.Context, args ...object.Object) object.Object {
+		result := applyCallback(ctx, "compose", fns[len(fns)-1], args)
+		for i := len(fns) - 2; i >= 0; i-- {
+			if isError(result) {
+				return result
+			}
+			result = applyCallback(ctx, "compose", fns[i], []object.Object{result})
+		}
+		return result
+	}
+
+	return &object.Builtin{Name: "<composed>", Fn: composed}
+}
+
+// partial(f, args...) returns a function that calls f with args followed
+// by the arguments it is itself called with.
+func builtinPartial(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments to `partial`. got=0, want at least 1")
+	}
+	if !isCallable(args[0]) {
+		return newError("argument 1 to `partial` must be a function, got %s", args[0].Type())
+	}
+
+	fn := args[0]
+	bound := append([]object.Object{}, args[1:]...)
+	partial := func(ctx context.Context, args ...object.Object) object.Object {
+		all := make([]object.Object, 0, len(bound)+len(args))
+		all = append(all, bound...)
+		all = append(all, args...)
+		return applyCallback(ctx, "partial", fn, all)
+	}
+
+	return &object.Builtin{Name: "<partial>", Fn: partial}
+}
+
+// memoize(f) returns a function that calls f and remembers the result for
+// each combination of arguments. Calls with an argument that is not
+// Hashable, and calls that fail, are passed through without caching.
+func builtinMemoize(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments to `memoize`. got=%d, want=1", len(args))
+	}
+	if !isCallable(args[0]) {
+		return newError("argument 1 to `memoize` must be a function, got %s", args[0].Type())
+	}
+
+	fn := args[0]
+	var mu sync.Mutex
+	cache := map[string]object.Object{}
+
+	memoized := func(ctx context.Context, args ...object.Object) object.Object {
+		key, ok := argumentsKey(args)
+		if !ok {
+			return applyCallback(ctx, "memoize", fn, args)
+		}
+
+		mu.Lock()
+		result, ok := cache[key]
+		mu.Unlock()
+		if ok {
+			return result
+		}
+
+		result = applyCallback(ctx, "memoize", fn, args)
+		if !isError(result) {
+			mu.Lock()
+			cache[key] = result
+			mu.Unlock()
+		}
+		return result
+	}
+
+	return &object.Builtin{Name: "<memoized>", Fn: memoized}
+}
+
+// argumentsKey combines the hash keys of args into one map key. It reports
+// false if any argument is not Hashable.
+func argumentsKey(args []object.Object) (string, bool) {
+	key := make([]byte, 0, len(args)*16)
+	for _, arg := range args {
+		h, ok := arg.(object.Hashable)
+		if !ok {
+			return "", false
+		}
+		hk := h.HashKey()
+		key = append(key, hk.Type...)
+		key = append(key, ':')
+		key = strconv.AppendUint(key, hk.Value, 10)
+		key = append(key, ';')
+	}
+	return string(key), true
+}
+
+// with_timeout(ms, f) calls f() under a deadline of ms milliseconds. It
+// relies on the evaluator's cancellation checks, so f is stopped at its
+// next statement or call once the deadline passes.
+func builtinWithTimeout(ctx context.Context, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments to `with_timeout`. got=%d, want=2", len(args))
+	}
+	ms, ok := args[0].(*object.Integer)
+	if !ok {
+		return newError("argument 1 to `with_timeout` must be INTEGER, got %s", args[0].Type())
+	}
+	if ms.Value < 0 {
+		return newError("argument 1 to `with_timeout` must not be negative, got %d", ms.Value)
+	}
+	if ms.Value > math.MaxInt64/int64(time.Millisecond) {
+		return newError("argument 1 to `with_timeout` is too large, got %d", ms.Value)
+	}
+	if !isCallable(args[1]) {
+		return newError("argument 2 to `with_timeout` must be a function, got %s", args[1].Type())
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, time.Duration(ms.Value)*time.Millisecond)
+	defer cancel()
+
+	result := applyCallback(tctx, "with_timeout", args[1], nil)
+	if isError(result) && ctx.Err() == nil && errors.Is(tctx.Err(), context.DeadlineExceeded) {
+		return newError("timeout: function did not finish within %dms", ms.Value)
+	}
+	return result
+}
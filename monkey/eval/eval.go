@@ -1,6 +1,10 @@
+// Package eval is the tree-walking evaluator. Its exported functions serve
+// the interpreter's own commands and tools and may change between
+// releases; package monkey is the stable way to run Monkey code.
 package eval
 
 import (
+	"context"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
@@ -12,80 +16,161 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+// Eval evaluates node in the environment e. A Go panic while evaluating is
+// always an interpreter bug; rather than crashing the host it is reported
+// as an internal error object carrying the position of the innermost node
+// being evaluated.
 func Eval(node ast.Node, e *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, e)
+}
+
+// EvalContext is like Eval but stops with an error object once ctx is done.
+// Cancellation is checked before every statement and function call, so
+// long-running programs can be interrupted.
+func EvalContext(ctx context.Context, node ast.Node, e *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newInternalError(r)
+		}
+	}()
+
+	return eval(withCallStack(ctx), node, e)
+}
+
+// internalPanic carries a recovered panic up to Eval along with the node
+// that was being evaluated when it happened.
+type internalPanic struct {
+	value interface{}
+	node  ast.Node
+}
+
+// annotatePanic is deferred by eval to tag an in-flight panic with the
+// innermost node that has a position. Frames further up pass the tagged
+// panic on unchanged.
+func annotatePanic(node ast.Node) {
+	if r := recover(); r != nil {
+		if _, ok := r.(*internalPanic); !ok && ast.TokenOf(node) != nil {
+			r = &internalPanic{value: r, node: node}
+		}
+		panic(r)
+	}
+}
+
+func newInternalError(r interface{}) object.Object {
+	ip, ok := r.(*internalPanic)
+	if !ok {
+		return newError("internal interpreter error: %v", r)
+	}
+	tok := ast.TokenOf(ip.node)
+	return newError("internal interpreter error at line %d, column %d: %v",
+		tok.Line, tok.Column, ip.value)
+}
+
+func eval(ctx context.Context, node ast.Node, e *object.Environment) object.Object {
+	defer annotatePanic(node)
+
+	stats := statsFrom(ctx)
+	if stats != nil {
+		stats.Nodes++
+	}
+
 	switch node := node.(type) {
 
 	case *ast.Program:
-		return evalProgram(node, e)
+		return evalProgram(ctx, node, e)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, e)
+		return eval(ctx, node.Expression, e)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, e)
+		val := eval(ctx, node.ReturnValue, e)
 		if isError(val) {
 			return val
 		}
-		return &object.ReturnValue{Value: val}
+		return stats.allocated(&object.ReturnValue{Value: val})
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, e)
+		return evalBlockStatement(ctx, node, e)
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, e)
+		val := eval(ctx, node.Value, e)
 		if isError(val) {
 			return val
 		}
+		if val == NULL && node.Else != nil {
+			return evalLetElse(ctx, node, e)
+		}
+		if node.Names != nil {
+			return bindTuple(node.Names, val, e)
+		}
 		e.Set(node.Name.Value, val)
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return stats.allocated(&object.Integer{Value: node.Value})
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.FunctionLiteral:
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: e}
+		env := e
+		if node.Captures != nil {
+			env = e.Trim(node.Captures)
+		}
+		return stats.allocated(&object.Function{Parameters: node.Parameters, Body: node.Body, Env: env})
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, e)
+		right := eval(ctx, node.Right, e)
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return stats.allocated(evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, e)
+		left := eval(ctx, node.Left, e)
 		if isError(left) {
 			return left
 		}
 
-		right := Eval(node.Right, e)
+		right := eval(ctx, node.Right, e)
 		if isError(right) {
 			return right
 		}
 
-		return evalInfixExpression(left, node.Operator, right)
+		return stats.allocated(evalInfixExpression(left, node.Operator, right))
 
 	case *ast.IfExpression:
-		return evalIfExpression(node, e)
+		return evalIfExpression(ctx, node, e)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, e)
 
 	case *ast.CallExpression:
-		return evalCallExpression(node, e)
+		return evalCallExpression(ctx, node, e)
+
+	case *ast.TupleLiteral:
+		elements := make([]object.Object, len(node.Elements))
+		for i, el := range node.Elements {
+			elements[i] = eval(ctx, el, e)
+			if isError(elements[i]) {
+				return elements[i]
+			}
+		}
+		return stats.allocated(&object.Tuple{Elements: elements})
 
 	}
 
 	return nil
 }
 
-func evalProgram(program *ast.Program, e *object.Environment) object.Object {
+func evalProgram(ctx context.Context, program *ast.Program, e *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, e)
+		if err := checkCancelled(ctx); err != nil {
+			return err
+		}
+
+		result = eval(ctx, statement, e)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -95,14 +180,18 @@ func evalProgram(program *ast.Program, e *object.Environment) object.Object {
 		}
 	}
 
-	return result
+	return valueOrNull(result)
 }
 
-func evalBlockStatement(bs *ast.BlockStatement, e *object.Environment) object.Object {
+func evalBlockStatement(ctx context.Context, bs *ast.BlockStatement, e *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range bs.Statements {
-		result = Eval(statement, e)
+		if err := checkCancelled(ctx); err != nil {
+			return err
+		}
+
+		result = eval(ctx, statement, e)
 
 		if ret, ok := result.(*object.ReturnValue); ok {
 			return ret
@@ -113,9 +202,47 @@ func evalBlockStatement(bs *ast.BlockStatement, e *object.Environment) object.Ob
 		}
 	}
 
+	return valueOrNull(result)
+}
+
+// valueOrNull turns the missing value of an empty program or block, or of
+// one ending in a let statement, into NULL, so that every program and
+// block has a value.
+func valueOrNull(result object.Object) object.Object {
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
+// bindTuple binds each of names to the matching element of val, which must
+// be a tuple of the same length.
+func bindTuple(names []*ast.Identifier, val object.Object, e *object.Environment) object.Object {
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = name.Value
+	}
+	return BindTuple(e, values, val)
+}
+
+// evalLetElse runs the else block of a let statement whose value is null.
+// The block has to leave the enclosing function or program, by returning or
+// failing, since there is no value to bind otherwise.
+func evalLetElse(ctx context.Context, node *ast.LetStatement, e *object.Environment) object.Object {
+	result := eval(ctx, node.Else, e)
+	if result != nil {
+		rt := result.Type()
+		if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			return result
+		}
+	}
+	name := "(...)"
+	if node.Names == nil {
+		name = node.Name.Value
+	}
+	return newError("else block of let %s must return", name)
+}
+
 func nativeBoolToBooleanObject(val bool) object.Object {
 	if val {
 		return TRUE
@@ -136,11 +263,17 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 
 func evalInfixExpression(left object.Object, operator string,
 	right object.Object) object.Object {
+	if result := evalHostInfixExpression(left, operator, right); result != nil {
+		return result
+	}
+
 	switch {
+	case operator == "==":
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
+	case operator == "!=":
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(left, operator, right)
-	case left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return evalBooleanInfixExpression(left, operator, right)
 	case left.Type() != right.Type():
 		return newError("type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -150,6 +283,48 @@ func evalInfixExpression(left object.Object, operator string,
 	}
 }
 
+// evalHostInfixExpression gives the handlers of registered host types the
+// first say on operators applied to their values, trying the left operand's
+// type first. It returns nil if no handler takes the operation.
+func evalHostInfixExpression(left object.Object, operator string, right object.Object) object.Object {
+	for _, typ := range []object.ObjectType{left.Type(), right.Type()} {
+		if t, ok := object.LookupType(typ); ok && t.Infix != nil {
+			if result := t.Infix(operator, left, right); result != nil {
+				return result
+			}
+		}
+	}
+	return nil
+}
+
+// objectsEqual implements == for every pair of values. Values of different
+// types are never equal, so `5 == true` is false rather than an error.
+// Integers compare by value and tuples element by element. Booleans and null are singletons and functions
+// have identity, so those compare by reference.
+func objectsEqual(left, right object.Object) bool {
+	if left.Type() != right.Type() {
+		return false
+	}
+
+	switch left := left.(type) {
+	case *object.Integer:
+		return left.Value == right.(*object.Integer).Value
+	case *object.Tuple:
+		other := right.(*object.Tuple)
+		if len(left.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range left.Elements {
+			if !objectsEqual(left.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return left == right
+	}
+}
+
 func evalIntegerInfixExpression(left object.Object, operator string,
 	right object.Object) object.Object {
 
@@ -164,29 +339,14 @@ func evalIntegerInfixExpression(left object.Object, operator string,
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
-	}
-}
-
-func evalBooleanInfixExpression(left object.Object, operator string,
-	right object.Object) object.Object {
-
-	switch operator {
-	case "==":
-		return nativeBoolToBooleanObject(left == right)
-	case "!=":
-		return nativeBoolToBooleanObject(left != right)
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
@@ -211,65 +371,170 @@ func evalNegOperatorExpression(right object.Object) object.Object {
 		return newError("unknown operator: -%s", right.Type())
 	}
 
-	res := right.(*object.Integer)
-	res.Value = -res.Value
-	return res
+	// Integers may be shared by bindings and closures, so negation must
+	// produce a new value rather than flip the operand in place.
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
 }
 
-func evalIfExpression(ie *ast.IfExpression, e *object.Environment) object.Object {
-	if cond := Eval(ie.Condition, e); isTruthy(cond) {
-		return evalBlockStatement(ie.Consequence, e)
+// evalIfExpression evaluates the condition and then only the branch it
+// selects. An error in the condition is returned before either branch runs.
+func evalIfExpression(ctx context.Context, ie *ast.IfExpression, e *object.Environment) object.Object {
+	cond := eval(ctx, ie.Condition, e)
+	if isError(cond) {
+		return cond
+	}
+
+	if isTruthy(cond) {
+		return evalBlockStatement(ctx, ie.Consequence, e)
 	} else if ie.Alternative != nil {
-		return evalBlockStatement(ie.Alternative, e)
+		return evalBlockStatement(ctx, ie.Alternative, e)
 	}
 
 	return NULL
 }
 
+// evalIdentifier looks ident up in e and then among the builtins.
+// Identifiers marked Unbound are resolved by evalUnbound instead.
 func evalIdentifier(ident *ast.Identifier, e *object.Environment) object.Object {
-	val, ok := e.Get(ident.Value)
+	if ident.Unbound {
+		return evalUnbound(ident, e)
+	}
 
-	if !ok {
-		return newError("identifier not found: %s", ident.Value)
+	if val, ok := e.Get(ident.Value); ok {
+		return val
+	}
+
+	if builtin, ok := builtins[ident.Value]; ok {
+		return builtin
+	}
+
+	return newError("identifier not found: %s", ident.Value)
+}
+
+// evalUnbound resolves an identifier that no let or parameter of its
+// program binds with Environment.GetUnbound, which skips the environments
+// of calls, and then among the builtins. The result is cached on the node
+// together with the environment it was found from and object.Bindings, and
+// reused for as long as both stay the same.
+func evalUnbound(ident *ast.Identifier, e *object.Environment) object.Object {
+	scope := e.Outside()
+	version := object.Bindings()
+	if c, ok := ident.Cache.Load().(*unboundCache); ok && c.scope == scope && c.version == version {
+		return c.value
 	}
 
+	val, ok := scope.GetUnbound(ident.Value)
+	if !ok {
+		builtin, ok := builtins[ident.Value]
+		if !ok {
+			return newError("identifier not found: %s", ident.Value)
+		}
+		val = builtin
+	}
+	ident.Cache.Store(&unboundCache{scope: scope, version: version, value: val})
 	return val
 }
 
-func evalCallExpression(node *ast.CallExpression, e *object.Environment) object.Object {
-	f := Eval(node.Function, e)
+// unboundCache is what evalUnbound caches on an identifier.
+type unboundCache struct {
+	scope   *object.Environment
+	version uint64
+	value   object.Object
+}
+
+// evalCallExpression evaluates the callee first and then the arguments from
+// left to right, stopping at the first error. Only once every argument has
+// been evaluated is the call itself checked and made, so argument side
+// effects happen even if the arity turns out to be wrong.
+func evalCallExpression(ctx context.Context, node *ast.CallExpression, e *object.Environment) object.Object {
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
+	f := eval(ctx, node.Function, e)
 
 	if isError(f) {
 		return f
 	}
 
-	fn, ok := f.(*object.Function)
-	if !ok {
+	if !isCallable(f) {
 		return newError("not a function: %s", f.Type())
 	}
 
-	if len(node.Arguments) != len(fn.Parameters) {
-		return newError("Expected %d arguments. Got=%d", len(fn.Parameters), len(node.Arguments))
-	}
-
-	// extend function environment
-	ne := object.NewEnclosedEnvironment(fn.Env)
-
+	args := make([]object.Object, len(node.Arguments))
 	for i := range node.Arguments {
-		arg := Eval(node.Arguments[i], e)
+		arg := eval(ctx, node.Arguments[i], e)
 		if isError(arg) {
 			return arg
 		}
-		ne.Set(fn.Parameters[i].String(), arg)
+		args[i] = arg
+	}
+
+	stack := callStackFrom(ctx)
+	if err := stack.push(node, f); err != nil {
+		return err
+	}
+	defer stack.pop()
+
+	return applyTraced(ctx, node, f, args)
+}
+
+func isCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	default:
+		return false
 	}
+}
+
+// applyFunction calls fn, a Function or Builtin, with already evaluated
+// arguments. It is shared by call expressions and by builtins that call
+// back into Monkey code.
+func applyFunction(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	stats := statsFrom(ctx)
+	stats.enterCall(fn)
+	defer stats.leaveCall(fn)
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("Expected %d arguments. Got=%d", len(fn.Parameters), len(args))
+		}
+
+		// extend function environment
+		ne := object.NewCallEnvironment(fn.Env)
+		for i, param := range fn.Parameters {
+			ne.Set(param.Value, args[i])
+		}
+
+		evaluated := eval(ctx, fn.Body, ne)
+		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+			// unwrap return ojbect
+			return returnValue.Value
+		}
+		return evaluated
 
-	evaluated := Eval(fn.Body, ne)
-	if returnValue, ok := evaluated.(*object.ReturnValue); ok {
-		// unwrap return ojbect
-		return returnValue.Value
+	case *object.Builtin:
+		if err := checkCancelled(ctx); err != nil {
+			return err
+		}
+		return fn.Fn(ctx, args...)
+
+	default:
+		return newError("not a function: %s", fn.Type())
 	}
-	return evaluated
+}
 
+// checkCancelled returns an error object if ctx is done, or nil otherwise.
+func checkCancelled(ctx context.Context) object.Object {
+	select {
+	case <-ctx.Done():
+		return newError("evaluation cancelled: %v", ctx.Err())
+	default:
+		return nil
+	}
 }
 
 func isTruthy(obj object.Object) bool {
@@ -1,10 +1,20 @@
 package eval
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/testutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -71,6 +81,127 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestEqualitySemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		// values of different types are never equal
+		{"5 == true", false},
+		{"5 != true", true},
+		{"true == 1", false},
+		{"0 == false", false},
+		{"if (false) { 1 } == 0", false},
+		{"if (false) { 1 } == false", false},
+		{"fn(x) { x } == 1", false},
+		// null equals only null
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{"if (false) { 1 } != if (false) { 2 }", false},
+		// integers compare by value
+		{"-0 == 0", true},
+		{"2 * 3 == 6", true},
+		// functions compare by identity
+		{"let f = fn(x) { x }; f == f", true},
+		{"let f = fn(x) { x }; let g = f; f == g", true},
+		{"fn(x) { x } == fn(x) { x }", false},
+		{"let f = fn(x) { x }; f != fn(x) { x }", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestPrefixMinusSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// negation never changes its operand
+		{"let a = 5; -a; a", 5},
+		{"let a = 5; -a + -a; a", 5},
+		{"let a = 5; let b = -a; a + b", 0},
+		{"let a = 5; - -a; a", 5},
+		{"let a = 5; let f = fn() { a }; -f(); f()", 5},
+		{"let a = 5; let f = fn() { a }; -f() + -f()", -10},
+		{"let f = fn(x) { -x }; let a = 7; f(a) + a", 0},
+		// grouped and called operands
+		{"let a = 2; let b = 3; -(a + b)", -5},
+		{"let a = 2; let b = 3; -(a + b) * 2", -10},
+		{"let a = 2; let b = 3; -a * b", -6},
+		{"let f = fn() { 4 }; -f()", -4},
+		{"let f = fn() { 4 }; -f() * 2", -8},
+		{"let f = fn() { 4 }; 2 - -f()", 6},
+		{"let f = fn(x) { x }; -f(-3)", 3},
+		{"let f = fn(x) { fn(y) { x - y } }; -f(1)(3)", 2},
+		{"- -5", 5},
+		{"-(-5)", 5},
+		{"- - -5", -5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestOperatorMatrix(t *testing.T) {
+	operands := []struct {
+		src string
+		typ object.ObjectType
+	}{
+		{"1", object.INTEGER_OBJ},
+		{"true", object.BOOLEAN_OBJ},
+		{"if (false) { 1 }", object.NULL_OBJ},
+		{"fn() { 1 }", object.FUNCTION_OBJ},
+	}
+	operators := []string{"+", "-", "*", "/", "<", ">"}
+
+	for _, left := range operands {
+		for _, right := range operands {
+			for _, op := range operators {
+				input := fmt.Sprintf("let l = %s; let r = %s; l %s r", left.src, right.src, op)
+				evaluated := testEval(input)
+
+				if left.typ == object.INTEGER_OBJ && right.typ == object.INTEGER_OBJ {
+					if isError(evaluated) {
+						t.Errorf("%q: unexpected error %q", input, evaluated.Inspect())
+					}
+					continue
+				}
+
+				want := fmt.Sprintf("unknown operator: %s %s %s", left.typ, op, right.typ)
+				if left.typ != right.typ {
+					want = fmt.Sprintf("type mismatch: %s %s %s", left.typ, op, right.typ)
+				}
+				errObj, ok := evaluated.(*object.Error)
+				if !ok || errObj.Message != want {
+					t.Errorf("%q: expected error %q. got=%s", input, want, evaluated.Inspect())
+				}
+			}
+
+			for _, op := range []string{"==", "!="} {
+				input := fmt.Sprintf("let l = %s; let r = %s; l %s r", left.src, right.src, op)
+				if _, ok := testEval(input).(*object.Boolean); !ok {
+					t.Errorf("%q: expected a boolean", input)
+				}
+			}
+		}
+	}
+
+	for _, operand := range operands {
+		if operand.typ == object.INTEGER_OBJ {
+			continue
+		}
+		input := fmt.Sprintf("let x = %s; -x", operand.src)
+		want := fmt.Sprintf("unknown operator: -%s", operand.typ)
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || errObj.Message != want {
+			t.Errorf("%q: expected error %q", input, want)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -158,6 +289,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"let f = fn(x) { 10 / x }; f(0)",
+			"division by zero",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -197,6 +332,14 @@ func TestErrorHandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			"5 < true",
+			"type mismatch: INTEGER < BOOLEAN",
+		},
+		{
+			"true > false",
+			"unknown operator: BOOLEAN > BOOLEAN",
+		},
 		{
 			`
             let foobay = 2;
@@ -232,6 +375,126 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestInternalErrorRecovery(t *testing.T) {
+	builtins["explode"] = &object.Builtin{Name: "explode", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		var tuple *object.Tuple
+		return tuple.Elements[0]
+	}}
+	defer delete(builtins, "explode")
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			"explode()",
+			"internal interpreter error at line 1, column 8: runtime error: invalid memory address or nil pointer dereference",
+		},
+		{
+			"let a = 5;\nlet f = fn(x) { a + explode() };\nf(0);",
+			"internal interpreter error at line 2, column 28: runtime error: invalid memory address or nil pointer dereference",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got %T(%+v)",
+				evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected %q, got %q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	input := `
+let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } };
+f(40);
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got %T(%+v)", evaluated, evaluated)
+	}
+	expected := "evaluation cancelled: context deadline exceeded"
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	input := `let down = fn(n) { if (n == 0) { 0 } else { down(n - 1) } };
+let start = fn(n) { down(n) };
+start(%d)`
+
+	tests := []struct {
+		depth, max int
+		expected   string
+	}{
+		{3, 5, "0"},
+		{100, 5, `maximum call depth 5 exceeded
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 2, column 25)
+	at start (line 3, column 6)`},
+		{100, 12, `maximum call depth 12 exceeded
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	… 3 frames elided …
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 2, column 25)
+	at start (line 3, column 6)`},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(fmt.Sprintf(input, tt.depth))).ParseProgram()
+		ctx := WithMaxCallDepth(context.Background(), tt.max)
+		if got := EvalContext(ctx, program, object.NewEnvironment()).Inspect(); got != tt.expected {
+			t.Errorf("depth %d, max %d: expected:\n%s\ngot:\n%s", tt.depth, tt.max, tt.expected, got)
+		}
+	}
+
+	// Without a limit set, the default keeps runaway recursion in check.
+	evaluated := testEval("let f = fn() { f() }; f()")
+	if errObj, ok := evaluated.(*object.Error); !ok || !strings.Contains(errObj.Message, "… 9991 frames elided …") {
+		t.Errorf("expected a truncated trace. got=%s", evaluated.Inspect())
+	}
+
+	// Calls made from Go count too and are listed by the function called.
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(fmt.Sprintf(input, 100))).ParseProgram(), env)
+	start, _ := env.Get("start")
+	ctx := WithMaxCallDepth(context.Background(), 3)
+	expected := `maximum call depth 3 exceeded
+	at down (line 1, column 49)
+	at down (line 1, column 49)
+	at down (line 2, column 25)
+	at fn(n)`
+	if got := Apply(ctx, start, []object.Object{&object.Integer{Value: 100}}).Inspect(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -248,6 +511,23 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestStatementsWithoutValue(t *testing.T) {
+	tests := []string{
+		"",
+		"let a = 5;",
+		"let a = 5; let b = a;",
+		"if (true) {}",
+		"if (true) { let a = 5; }",
+		"fn() {}()",
+		"fn() { let a = 5; }()",
+		"let f = fn() { return 1, 2; }; let (a, b) = f();",
+	}
+
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
@@ -284,6 +564,584 @@ addTwo(2);
 	testIntegerObject(t, testEval(input), 4)
 }
 
+func TestClosureCaptures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// recursion through a name bound after the closure is created
+		{"let outer = fn() { let f = fn(n) { if (n < 1) { 0 } else { f(n - 1) + 1 } }; f(3) }; outer()", 3},
+		// a scope the closure does not use is dropped, used ones are kept
+		{"let mk = fn(a) { let unused = 99; fn(b) { fn(c) { a + c } } }; mk(1)(2)(3)", 4},
+		{"let mk = fn(a) { fn(b) { let g = fn() { a + b + later }; let later = 10; g() } }; mk(1)(2)", 13},
+		{"let x = 1; let f = fn() { x + compose(fn(v) { v })(1) }; f()", 2},
+		// a scope that does not bind a name yet may still shadow it
+		{"let x = 1; fn() { let mk = fn() { fn() { x } }; let g = mk(); let x = 2; g() }()", 2},
+		{"let mk = fn() { fn() { helper() } }; let c = mk(); let helper = fn() { 7 }; c()", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// the scope of a clone binds names the snapshot does not know about
+	snapshot := object.NewEnvironment().Snapshot()
+	program := parser.New(lexer.New(tests[len(tests)-1].input)).ParseProgram()
+	testIntegerObject(t, Eval(program, snapshot.Clone()), 7)
+}
+
+func TestTuples(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+let divmod = fn(a, b) { let q = a / b; return q, a - q * b; };
+let (q, r) = divmod(17, 5);
+q * 10 + r
+`, 32},
+		{"let f = fn() { return 1, 2, 3; }; let (a, b, c) = f(); a + b + c", 6},
+		{"let f = fn() { return 1, true; }; let (a, b) = f(); if (b) { a }", 1},
+		{"let f = fn() { return 1, 2; }; f() == f()", true},
+		{"let f = fn(x) { return x, 2; }; f(1) == f(2)", false},
+		{"let f = fn() { return 1, 2; }; let (x) = f(); x", "cannot destructure tuple of 2 values into 1 names"},
+		{"let (a, b) = 5;", "cannot destructure INTEGER into 2 names"},
+		{"let f = fn() { return 1, true + 1; }; f()", "type mismatch: BOOLEAN + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got %T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+
+	evaluated := testEval("let f = fn() { return 1, true; }; f()")
+	if evaluated.Inspect() != "(1, true)" {
+		t.Errorf("wrong tuple inspect. got=%q", evaluated.Inspect())
+	}
+}
+
+func TestLetElse(t *testing.T) {
+	maybe := "let maybe = fn(ok) { if (ok) { 1 } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 5 else { return 0; }; x", 5},
+		{maybe + "let f = fn(ok) { let x = maybe(ok) else { return 0; }; x + 1 }; f(true)", 2},
+		{maybe + "let f = fn(ok) { let x = maybe(ok) else { return 0; }; x + 1 }; f(false)", 0},
+		{maybe + "let x = maybe(false) else { return 7; }; x", 7},
+		{"let f = fn() { return 1, 2; }; let (a, b) = f() else { return 0; }; a + b", 3},
+		{maybe + "let (a, b) = maybe(false) else { return 9; }; a", 9},
+		{maybe + "let x = maybe(false) else { 1 }; x", "else block of let x must return"},
+		{maybe + "let (a, b) = maybe(false) else {}; a", "else block of let (...) must return"},
+		{maybe + "let x = maybe(false) else { 1 + true }; x", "type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1 + true else { return 0; }; x", "type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got %T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestComposeAndPartial(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, dbl)(5)", 11},
+		{"let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(dbl, inc)(5)", 12},
+		{"let inc = fn(x) { x + 1 }; compose(inc)(1)", 2},
+		{"let inc = fn(x) { x + 1 }; compose(inc, inc, inc)(0)", 3},
+		{"let add = fn(a, b) { a + b }; let neg = fn(x) { -x }; compose(neg, add)(2, 3)", -5},
+		{"let add = fn(a, b) { a + b }; partial(add, 10)(5)", 15},
+		{"let add = fn(a, b) { a + b }; partial(add, 1, 2)()", 3},
+		{"let add = fn(a, b) { a + b }; partial(add)(1, 2)", 3},
+		{"let sub = fn(a, b) { a - b }; compose(partial(sub, 10), partial(sub, 3))(1)", 8},
+		{"let add = fn(a, b) { a + b }; let addTwo = partial(add, 2); compose(addTwo, addTwo)(0)", 4},
+		{"compose(partial(compose, fn(x) { x * 3 }), fn(f) { f })(fn(x) { x + 1 })(1)", 6},
+		{"let f = fn(x) { x }; compose(f, fn(x) { x + true })(1)", "type mismatch: INTEGER + BOOLEAN"},
+		{"let add = fn(a, b) { a + b }; partial(add, 1)(2, 3)", "Expected 2 arguments. Got=3"},
+		{"compose()", "wrong number of arguments to `compose`. got=0, want at least 1"},
+		{"compose(fn(x) { x }, 1)", "argument 2 to `compose` must be a function, got INTEGER"},
+		{"partial()", "wrong number of arguments to `partial`. got=0, want at least 1"},
+		{"partial(true, 1)", "argument 1 to `partial` must be a function, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got %T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	fib := "let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } }; "
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"with_timeout(1000, fn() { 1 + 2 })", 3},
+		{fib + "with_timeout(1000, fn() { fib(10) })", 55},
+		{fib + "with_timeout(5, fn() { fib(40) })", "timeout: function did not finish within 5ms"},
+		{"with_timeout(1000, fn() { 1 + true })", "type mismatch: INTEGER + BOOLEAN"},
+		{"with_timeout(1000, fn(x) { x })", "Expected 1 arguments. Got=0"},
+		{"with_timeout(1000)", "wrong number of arguments to `with_timeout`. got=1, want=2"},
+		{"with_timeout(true, fn() { 1 })", "argument 1 to `with_timeout` must be INTEGER, got BOOLEAN"},
+		{"with_timeout(-1, fn() { 1 })", "argument 1 to `with_timeout` must not be negative, got -1"},
+		{"with_timeout(9223372036855, fn() { 1 })", "argument 1 to `with_timeout` is too large, got 9223372036855"},
+		{"with_timeout(9223372036854, fn() { 1 })", 1},
+		{"with_timeout(1, 1)", "argument 2 to `with_timeout` must be a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got %T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+
+	// an outer cancellation is reported as such, not as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	program := parser.New(lexer.New("with_timeout(1000, fn() { 1 })")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment())
+	if errObj, ok := evaluated.(*object.Error); !ok || !strings.HasPrefix(errObj.Message, "evaluation cancelled") {
+		t.Errorf("expected a cancellation error. got=%+v", evaluated)
+	}
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	names := BuiltinNames()
+	if len(names) == 0 {
+		t.Fatal("no builtins")
+	}
+
+	for _, name := range names {
+		b, ok := LookupBuiltin(name)
+		if !ok {
+			t.Fatalf("listed builtin %s not found", name)
+		}
+		if b.Name != name {
+			t.Errorf("builtin %s is registered as %s", b.Name, name)
+		}
+		if !strings.HasPrefix(b.Signature, name+"(") {
+			t.Errorf("builtin %s has a bad signature: %q", name, b.Signature)
+		}
+		if b.Doc == "" {
+			t.Errorf("builtin %s is undocumented", name)
+		}
+	}
+}
+
+func TestMemoize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+let fib = memoize(fn(n) {
+  if (n < 2) { n } else { fib(n - 1) + fib(n - 2) }
+});
+fib(80);
+`, 23416728348467685},
+		{"let add = memoize(fn(a, b) { a + b }); add(1, 2) + add(1, 2) + add(2, 1)", 9},
+		{"let f = memoize(fn(b) { if (b) { 1 } else { 2 } }); f(true) + f(false) + f(true)", 4},
+		{"let id = memoize(fn(x) { x }); let g = fn() { 7 }; id(g)()", 7},
+		{"let f = memoize(fn(x) { x + true }); f(1)", "type mismatch: INTEGER + BOOLEAN"},
+		{"memoize()", "wrong number of arguments to `memoize`. got=0, want=1"},
+		{"memoize(5)", "argument 1 to `memoize` must be a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%q: no error object returned. got %T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected %q, got %q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMemoizeCachesResults(t *testing.T) {
+	input := "let f = memoize(fn(x) { calls(x) }); f(1); f(1); f(2);"
+
+	calls := 0
+	builtins["calls"] = &object.Builtin{Name: "calls", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		calls++
+		return args[0]
+	}}
+	defer delete(builtins, "calls")
+
+	testEval(input)
+
+	if calls != 2 {
+		t.Errorf("memoized function called wrapped function %d times, want 2", calls)
+	}
+}
+
+func TestEvaluationOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // recorded values in the order they were evaluated
+	}{
+		// operands and arguments run left to right
+		{"record(1) + record(2) * record(3)", "1 2 3"},
+		{"-record(1) - -record(2)", "1 2"},
+		{"let f = fn(a, b, c) { c }; f(record(1), record(2), record(3))", "1 2 3"},
+		{"let f = fn() { return record(1), record(2); }; f()", "1 2"},
+		// the callee is evaluated before its arguments
+		{"record(fn(x) { x })(record(1))", "fn(x) {\nx\n} 1"},
+		{"let f = fn(x) { record(x); fn(y) { y } }; f(1)(record(2))", "1 2"},
+		// arity is checked after the arguments ran
+		{"fn(a) { a }(record(1), record(2))", "1 2"},
+		// the first error stops everything after it
+		{"let f = fn(a, b, c) { c }; f(record(1), 1 + true, record(3))", "1"},
+		{"(1 + true) + record(1)", ""},
+		{"record(1); record(2); 1 + true; record(3)", "1 2"},
+		{"record(1)(record(2))", "1"},
+		// only the selected branch runs, and never on a failed condition
+		{"if (record(true)) { record(1) } else { record(2) }", "true 1"},
+		{"if (record(false)) { record(1) } else { record(2) }", "false 2"},
+		{"if (record(false)) { record(1) }", "false"},
+		{"if (1 + true) { record(1) } else { record(2) }", ""},
+		// statements run in sequence until a return
+		{"let a = record(1); let b = record(2); record(a + b)", "1 2 3"},
+		{"fn() { record(1); return record(2); record(3) }()", "1 2"},
+		{"if (true) { record(1); if (true) { return record(2); } record(3) } record(4)", "1 2"},
+	}
+
+	for _, tt := range tests {
+		recorded := []string{}
+		builtins["record"] = &object.Builtin{Name: "record", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+			recorded = append(recorded, args[0].Inspect())
+			return args[0]
+		}}
+
+		testEval(tt.input)
+
+		if got := strings.Join(recorded, " "); got != tt.expected {
+			t.Errorf("%q: wrong evaluation order. expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+	delete(builtins, "record")
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	rolls := 0
+	builtins["roll"] = &object.Builtin{Name: "roll", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		rolls++
+		return &object.Integer{Value: int64(rolls * 7 % 6)}
+	}}
+	defer delete(builtins, "roll")
+
+	input := `
+let add = fn(a, b) { a + b };
+let pair = fn() { return roll(), roll(); };
+let (a, b) = pair();
+add(a, b) + roll()
+`
+	run := func(ctx context.Context, input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return EvalContext(ctx, program, object.NewEnvironment())
+	}
+
+	var trace bytes.Buffer
+	recorder := NewRecorder(&trace)
+	recorded := run(WithRecorder(context.Background(), recorder), input)
+	if recorder.Err() != nil {
+		t.Fatalf("recording failed: %s", recorder.Err())
+	}
+	if n := strings.Count(trace.String(), "\n"); n != 5 {
+		t.Fatalf("expected 5 recorded calls. got=%d\n%s", n, trace.String())
+	}
+
+	replayer, err := NewReplayer(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatalf("could not read trace: %s", err)
+	}
+	replayed := run(WithReplayer(context.Background(), replayer), input)
+	if rolls != 3 {
+		t.Errorf("builtins ran during replay. rolls=%d", rolls)
+	}
+	if diff := object.Diff(recorded, replayed); diff != "" {
+		t.Errorf("replay differs from the recording: %s", diff)
+	}
+
+	replayer, err = NewReplayer(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatalf("could not read trace: %s", err)
+	}
+	diverged := run(WithReplayer(context.Background(), replayer), strings.Replace(input, "add(a, b)", "add(b, a)", 1))
+	errObj, ok := diverged.(*object.Error)
+	if !ok {
+		t.Fatalf("expected divergence error. got=%T (%+v)", diverged, diverged)
+	}
+	if errObj.Message != "replay diverged at call 4 (line 5): add" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestRecordAndReplayCallbacks(t *testing.T) {
+	rolls := 0
+	builtins["roll"] = &object.Builtin{Name: "roll", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		rolls++
+		return &object.Integer{Value: int64(rolls * 7 % 6)}
+	}}
+	defer delete(builtins, "roll")
+
+	input := `
+let twice = compose(fn(x) { x * 2 }, roll);
+let inc = partial(fn(a, b) { a + b }, 1);
+twice() + inc(roll())
+`
+	run := func(ctx context.Context) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return EvalContext(ctx, program, object.NewEnvironment())
+	}
+
+	var trace bytes.Buffer
+	recorded := run(WithRecorder(context.Background(), NewRecorder(&trace)))
+	for _, call := range []string{`"compose: \u003cbuiltin roll\u003e"`, `"compose: fn(x)"`, `"partial: fn(a, b)"`} {
+		if !strings.Contains(trace.String(), `"call":`+call) {
+			t.Errorf("trace does not record %s:\n%s", call, trace.String())
+		}
+	}
+
+	replayer, err := NewReplayer(bytes.NewReader(trace.Bytes()))
+	if err != nil {
+		t.Fatalf("could not read trace: %s", err)
+	}
+	replayed := run(WithReplayer(context.Background(), replayer))
+	if rolls != 2 {
+		t.Errorf("builtins ran during replay. rolls=%d", rolls)
+	}
+	if diff := object.Diff(recorded, replayed); diff != "" {
+		t.Errorf("replay differs from the recording: %s", diff)
+	}
+}
+
+func TestStats(t *testing.T) {
+	input := `
+let countdown = fn(n) { if (n < 1) { return 0; } countdown(n - 1) };
+countdown(3);
+let pair = fn() { return -1, true; };
+pair();
+`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	var stats Stats
+	EvalContext(WithStats(context.Background(), &stats), program, object.NewEnvironment())
+
+	if stats.Calls != 5 {
+		t.Errorf("wrong number of calls. got=%d", stats.Calls)
+	}
+	if stats.MaxDepth != 4 {
+		t.Errorf("wrong max depth. got=%d", stats.MaxDepth)
+	}
+	if stats.Nodes == 0 {
+		t.Errorf("no nodes counted")
+	}
+
+	expected := map[object.ObjectType]int{
+		// 3 and 0 once, 1 in every n < 1, 1 and the result of every
+		// n - 1, and both 1 and -1 in pair
+		object.INTEGER_OBJ:      2 + 4 + 2*3 + 2,
+		object.FUNCTION_OBJ:     2,
+		object.RETURN_VALUE_OBJ: 2,
+		object.TUPLE_OBJ:        1,
+	}
+	for typ, want := range expected {
+		if got := stats.Allocated[typ]; got != want {
+			t.Errorf("wrong number of %s allocated. want=%d, got=%d", typ, want, got)
+		}
+	}
+}
+
+func TestHostTypes(t *testing.T) {
+	type cents int64
+
+	moneyType := object.HostType{
+		Name:    "MONEY",
+		Inspect: func(v interface{}) string { return fmt.Sprintf("$%d.%02d", v.(cents)/100, v.(cents)%100) },
+		Infix: func(operator string, left, right object.Object) object.Object {
+			l, lok := left.(*object.Host)
+			r, rok := right.(*object.Host)
+			if !lok || !rok {
+				return nil
+			}
+			switch operator {
+			case "+":
+				return object.NewHost(l.HostType, l.Value.(cents)+r.Value.(cents))
+			case "<":
+				return nativeBoolToBooleanObject(l.Value.(cents) < r.Value.(cents))
+			}
+			return nil
+		},
+	}
+	// the registry is global, so the type survives repeated test runs
+	money, ok := object.LookupType(moneyType.Name)
+	if !ok {
+		var err error
+		if money, err = object.RegisterType(moneyType); err != nil {
+			t.Fatalf("could not register host type: %s", err)
+		}
+	}
+	if _, err := object.RegisterType(object.HostType{Name: "MONEY"}); err == nil {
+		t.Errorf("registering MONEY twice succeeded")
+	}
+	if _, err := object.RegisterType(object.HostType{Name: object.INTEGER_OBJ}); err == nil {
+		t.Errorf("registering INTEGER succeeded")
+	}
+
+	builtins["cents"] = &object.Builtin{Name: "cents", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		return object.NewHost(money, cents(args[0].(*object.Integer).Value))
+	}}
+	defer delete(builtins, "cents")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"cents(150) + cents(275)", "MONEY $4.25"},
+		{"cents(150) < cents(275)", "BOOLEAN true"},
+		{"let a = cents(1); a == a", "BOOLEAN true"},
+		{"cents(1) == cents(1)", "BOOLEAN false"},
+		{"cents(1) * cents(2)", "ERROR_OBJ unknown operator: MONEY * MONEY"},
+		{"cents(1) + 1", "ERROR_OBJ type mismatch: MONEY + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		got := strings.TrimSuffix(testutil.RenderObject(testEval(tt.input)), "\n")
+		if got != tt.expected {
+			t.Errorf("%q: expected %q. got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSnapshotClones(t *testing.T) {
+	prelude := `
+let square = fn(x) { x * x };
+let limit = 100;
+let clamp = fn(x) { if (x > limit) { limit } else { x } };
+`
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(prelude)).ParseProgram(), env)
+	snapshot := env.Snapshot()
+
+	program := parser.New(lexer.New("let limit = 5; clamp(square(n)) + limit")).ParseProgram()
+
+	var wg sync.WaitGroup
+	results := make([]object.Object, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clone := snapshot.Clone()
+			clone.Set("n", &object.Integer{Value: int64(i)})
+			results[i] = Eval(program, clone)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		// clamp still sees the prelude's limit
+		expected := int64(i*i) + 5
+		if i*i > 100 {
+			expected = 105
+		}
+		testIntegerObject(t, result, expected)
+	}
+
+	if limit, _ := snapshot.Clone().Get("limit"); limit.Inspect() != "100" {
+		t.Errorf("snapshot changed by a clone. limit=%s", limit.Inspect())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("setting a name in a snapshot environment did not panic")
+		}
+	}()
+	env.Set("limit", &object.Integer{Value: 1})
+}
+
+func TestGoldenPrograms(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		evaluated := testEval(string(src))
+		testutil.Golden(t, strings.TrimSuffix(path, ".monkey")+".golden", testutil.RenderObject(evaluated))
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -332,3 +1190,133 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		files    []string
+		args     []int64
+		expected interface{}
+	}{
+		{[]string{"let x = 2;", "x * 3"}, nil, 6},
+		{[]string{"let double = fn(x) { x * 2 };", "let main = fn(a, b) { double(a) + b };"}, []int64{5, 1}, 11},
+		{[]string{"let main = fn() { return 3; 4 };"}, nil, 3},
+		{[]string{"let main = fn() { let y = 1; };"}, nil, nil},
+		{[]string{"let main = fn(a) { a };"}, nil, "Expected 1 arguments. Got=0"},
+		{[]string{"let main = 5;"}, nil, "not a function: INTEGER"},
+		{[]string{"let main = fn() { 1 };", "-true", "let x = 2;"}, nil, "unknown operator: -BOOLEAN"},
+		{[]string{}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		programs := []*ast.Program{}
+		for _, src := range tt.files {
+			p := parser.New(lexer.New(src))
+			programs = append(programs, p.ParseProgram())
+		}
+		args := []object.Object{}
+		for _, arg := range tt.args {
+			args = append(args, &object.Integer{Value: arg})
+		}
+
+		result := Run(context.Background(), programs, object.NewEnvironment(), args...)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case string:
+			errObj, ok := result.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%v: expected error %q. got=%s", tt.files, expected, result.Inspect())
+			}
+		default:
+			testNullObject(t, result)
+		}
+	}
+}
+
+func TestUnboundIdentifiers(t *testing.T) {
+	env := object.NewEnvironment()
+	run := func(input string) object.Object {
+		return Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	}
+
+	// names bound anywhere in the program are looked up as usual
+	if got := run("let f = fn(c) { if (c) { let partial = 1; }; partial }; f(false)"); got != builtins["partial"] {
+		t.Fatalf("expected builtin partial. got=%s", got.Inspect())
+	}
+	testIntegerObject(t, run("f(true)"), 1)
+
+	// unbound names are looked up outside the calls of nested closures,
+	// in the environment the program was evaluated in and then among the
+	// builtins, and the lookups are cached until a name is bound there
+	env.Set("limit", &object.Integer{Value: 10})
+	program := parser.New(lexer.New("let mk = fn(x) { fn() { compose; x + limit } }; mk(1)()")).ParseProgram()
+	idents := map[string]*ast.Identifier{}
+	ast.Walk(program, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Identifier); ok && id.Unbound {
+			idents[id.Value] = id
+		}
+		return true
+	})
+	if len(idents) != 2 || idents["limit"] == nil || idents["compose"] == nil {
+		t.Fatalf("expected limit and compose to be unbound. got=%v", idents)
+	}
+
+	testIntegerObject(t, Eval(program, env), 11)
+	if c, ok := idents["compose"].Cache.Load().(*unboundCache); !ok || c.value != builtins["compose"] {
+		t.Errorf("lookup of compose was not cached")
+	}
+	if c, ok := idents["limit"].Cache.Load().(*unboundCache); !ok || c.scope != env {
+		t.Errorf("lookup of limit was not cached")
+	}
+
+	env.Set("limit", &object.Integer{Value: 20})
+	testIntegerObject(t, Eval(program, env), 21)
+
+	// another environment does not see what was cached for this one
+	other := object.NewEnvironment()
+	other.Set("limit", &object.Integer{Value: 30})
+	testIntegerObject(t, Eval(program, other), 31)
+	errObj, ok := Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok || errObj.Message != "identifier not found: limit" {
+		t.Errorf("expected limit not to be found. got=%v", errObj)
+	}
+}
+
+// BenchmarkEvalUnbound measures lookups of names bound outside the
+// program, from a closure nested in calls under a clone of a snapshot,
+// with and without the cache of unbound identifiers.
+func BenchmarkEvalUnbound(b *testing.B) {
+	prelude := object.NewEnvironment()
+	prelude.Set("step", &object.Integer{Value: 1})
+	env := prelude.Snapshot().Clone()
+
+	src := `
+let count = fn(n) {
+	let inner = fn(n) { if (n == 0) { 0 } else { compose; partial; count(n - step) } };
+	inner(n)
+};
+count(200)`
+
+	run := func(b *testing.B, cached bool) {
+		program := parser.New(lexer.New(src)).ParseProgram()
+		if !cached {
+			ast.Walk(program, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Identifier); ok {
+					id.Unbound = false
+				}
+				return true
+			})
+		}
+		if got := Eval(program, env); got.Inspect() != "0" {
+			b.Fatalf("expected 0. got=%s", got.Inspect())
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			Eval(program, env)
+		}
+	}
+
+	b.Run("cached", func(b *testing.B) { run(b, true) })
+	b.Run("uncached", func(b *testing.B) { run(b, false) })
+}
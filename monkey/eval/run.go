@@ -0,0 +1,53 @@
+package eval
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+)
+
+// MAIN is the name of a program's entry point. See Run.
+const MAIN = "main"
+
+// Run evaluates programs in order in e, as the files of a single program,
+// and then, if they bind MAIN, calls it with args. The result is main's,
+// or that of the last program if there is no main. Evaluation stops at
+// the first error, which is returned.
+func Run(ctx context.Context, programs []*ast.Program, e *object.Environment, args ...object.Object) object.Object {
+	return RunFunc(ctx, e, func(ctx context.Context, e *object.Environment) object.Object {
+		result := object.Object(NULL)
+		for _, program := range programs {
+			result = eval(ctx, program, e)
+			if isError(result) {
+				break
+			}
+		}
+		return result
+	}, args...)
+}
+
+// RunFunc is Run for a program translated to Go, such as the function
+// package transpile emits: it calls program with e and then main, if
+// program binds it, with args.
+func RunFunc(ctx context.Context, e *object.Environment, program func(ctx context.Context, e *object.Environment) object.Object, args ...object.Object) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newInternalError(r)
+		}
+	}()
+
+	ctx = withCallStack(ctx)
+	result = program(ctx, e)
+	if isError(result) {
+		return result
+	}
+
+	main, ok := e.Get(MAIN)
+	if !ok {
+		return result
+	}
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+	return valueOrNull(applyFunction(ctx, main, args))
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"context"
+	"monkey/object"
+)
+
+// The functions below expose the evaluator's semantics to code that runs
+// Monkey programs without walking the tree, such as the Go emitted by
+// package transpile, so that both agree on every operator and error.
+
+// Infix applies a binary operator to two evaluated operands.
+func Infix(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(left, operator, right)
+}
+
+// Prefix applies a prefix operator to an evaluated operand.
+func Prefix(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// Truthy reports whether obj counts as true in a condition.
+func Truthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// Bool returns the Boolean object for b.
+func Bool(b bool) object.Object {
+	return nativeBoolToBooleanObject(b)
+}
+
+// Lookup resolves name in e or among the builtins, or returns an error.
+func Lookup(e *object.Environment, name string) object.Object {
+	if val, ok := e.Get(name); ok {
+		return val
+	}
+	if builtin, ok := builtins[name]; ok {
+		return builtin
+	}
+	return newError("identifier not found: %s", name)
+}
+
+// Apply calls fn with args, once ctx is checked for cancellation. The call
+// counts toward the limit on nested calls, as in WithMaxCallDepth.
+func Apply(ctx context.Context, fn object.Object, args []object.Object) object.Object {
+	if err := checkCancelled(ctx); err != nil {
+		return err
+	}
+
+	ctx = withCallStack(ctx)
+	stack := callStackFrom(ctx)
+	if err := stack.push(nil, fn); err != nil {
+		return err
+	}
+	defer stack.pop()
+
+	return applyFunction(ctx, fn, args)
+}
+
+// Callable returns the error a call expression reports if fn cannot be
+// called, which it does before evaluating any argument, or nil.
+func Callable(fn object.Object) object.Object {
+	if !isCallable(fn) {
+		return newError("not a function: %s", fn.Type())
+	}
+	return nil
+}
+
+// BindTuple binds names to the elements of val as `let (a, b) = val` does.
+// It returns an error object if val does not fit, and nil otherwise.
+func BindTuple(e *object.Environment, names []string, val object.Object) object.Object {
+	tuple, ok := val.(*object.Tuple)
+	if !ok {
+		return newError("cannot destructure %s into %d names", val.Type(), len(names))
+	}
+	if len(tuple.Elements) != len(names) {
+		return newError("cannot destructure tuple of %d values into %d names",
+			len(tuple.Elements), len(names))
+	}
+
+	for i, name := range names {
+		e.Set(name, tuple.Elements[i])
+	}
+	return nil
+}
+
+// Closure returns a function value whose body is Go code. Calling it binds
+// params to the arguments in a new environment enclosed by env and runs
+// body there, just as calling a Monkey function does. The value is a
+// builtin named "fn", since it has no syntax tree to show.
+func Closure(params []string, env *object.Environment, body func(ctx context.Context, env *object.Environment) object.Object) *object.Builtin {
+	return &object.Builtin{Name: "fn", Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		if len(args) != len(params) {
+			return newError("Expected %d arguments. Got=%d", len(params), len(args))
+		}
+
+		ne := object.NewCallEnvironment(env)
+		for i, param := range params {
+			ne.Set(param, args[i])
+		}
+		return body(ctx, ne)
+	}}
+}
@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+)
+
+// DefaultMaxCallDepth is how deeply calls may nest unless the context sets
+// another limit with WithMaxCallDepth. Runaway recursion then ends with an
+// error instead of exhausting the Go stack, which would crash the host.
+const DefaultMaxCallDepth = 10000
+
+// traceEdge is how many of the innermost and of the outermost calls the
+// error of a too deep recursion lists; the calls between are elided.
+const traceEdge = 5
+
+type maxCallDepthKey struct{}
+
+// WithMaxCallDepth returns a context in which evaluations fail once more
+// than n calls are nested. n <= 0 disables the limit.
+func WithMaxCallDepth(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, maxCallDepthKey{}, n)
+}
+
+// callStack holds the calls being evaluated, outermost first.
+type callStack struct {
+	calls []frame
+	max   int
+}
+
+// frame is a call on the stack: a call expression, or a call made from Go
+// through Apply, which only knows the function it calls.
+type frame struct {
+	call *ast.CallExpression
+	fn   object.Object
+}
+
+// String describes the call as the trace of a too deep recursion lists it.
+func (f frame) String() string {
+	if f.call == nil {
+		return "at " + describeCallee(f.fn)
+	}
+	return fmt.Sprintf("at %s (line %d, column %d)", f.call.Function.String(), f.call.Token.Line, f.call.Token.Column)
+}
+
+type callStackKey struct{}
+
+// withCallStack gives an evaluation starting at an entry point such as
+// EvalContext its call stack, unless ctx belongs to an evaluation that
+// already has one.
+func withCallStack(ctx context.Context) context.Context {
+	if ctx.Value(callStackKey{}) != nil {
+		return ctx
+	}
+	s := &callStack{max: DefaultMaxCallDepth}
+	if max, ok := ctx.Value(maxCallDepthKey{}).(int); ok {
+		s.max = max
+	}
+	return context.WithValue(ctx, callStackKey{}, s)
+}
+
+func callStackFrom(ctx context.Context) *callStack {
+	s, _ := ctx.Value(callStackKey{}).(*callStack)
+	return s
+}
+
+// push enters the call of fn made by node, which is nil for calls made
+// from Go, or returns an error with a trace of the calls if that would
+// nest them too deeply.
+func (s *callStack) push(node *ast.CallExpression, fn object.Object) object.Object {
+	if s == nil {
+		return nil
+	}
+	if s.max > 0 && len(s.calls) >= s.max {
+		return &object.Error{Message: s.trace(frame{node, fn})}
+	}
+	s.calls = append(s.calls, frame{node, fn})
+	return nil
+}
+
+func (s *callStack) pop() {
+	if s != nil {
+		s.calls = s.calls[:len(s.calls)-1]
+	}
+}
+
+// line returns the line of the innermost call expression on the stack, or
+// 0 if there is none.
+func (s *callStack) line() int {
+	if s == nil {
+		return 0
+	}
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		if s.calls[i].call != nil {
+			return s.calls[i].call.Token.Line
+		}
+	}
+	return 0
+}
+
+// trace describes the calls on the stack and the call that exceeded the
+// limit, innermost first. Only the traceEdge innermost and outermost calls
+// are listed.
+func (s *callStack) trace(last frame) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "maximum call depth %d exceeded", s.max)
+
+	calls := append(s.calls, last)
+	show := func(i int) {
+		out.WriteString("\n\t" + calls[i].String())
+	}
+
+	if len(calls) <= 2*traceEdge {
+		for i := len(calls) - 1; i >= 0; i-- {
+			show(i)
+		}
+		return out.String()
+	}
+	for i := len(calls) - 1; i >= len(calls)-traceEdge; i-- {
+		show(i)
+	}
+	fmt.Fprintf(&out, "\n\t… %d frames elided …", len(calls)-2*traceEdge)
+	for i := traceEdge - 1; i >= 0; i-- {
+		show(i)
+	}
+	return out.String()
+}
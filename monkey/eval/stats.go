@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"context"
+	"monkey/object"
+)
+
+// Stats collects counters about an evaluation, so hosts can monitor and
+// bill the programs they run. Attach it with WithStats and read it once
+// EvalContext returns; counters accumulate over every evaluation that uses
+// the same Stats. A Stats is not safe for concurrent use.
+type Stats struct {
+	Nodes    int // AST nodes evaluated
+	Calls    int // calls to functions and builtins
+	MaxDepth int // deepest nesting of Monkey function calls
+
+	// Allocated counts, per type, the objects created by literals,
+	// operators and return statements.
+	Allocated map[object.ObjectType]int
+
+	depth int
+}
+
+type statsKey struct{}
+
+// WithStats returns a context that makes EvalContext count into s.
+func WithStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, s)
+}
+
+func statsFrom(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// allocated counts obj if it is a newly created object rather than one of
+// the NULL, TRUE and FALSE singletons.
+func (s *Stats) allocated(obj object.Object) object.Object {
+	if s == nil || obj == NULL || obj == TRUE || obj == FALSE {
+		return obj
+	}
+	if s.Allocated == nil {
+		s.Allocated = map[object.ObjectType]int{}
+	}
+	s.Allocated[obj.Type()]++
+	return obj
+}
+
+func (s *Stats) enterCall(fn object.Object) {
+	if s == nil {
+		return
+	}
+	s.Calls++
+	if _, ok := fn.(*object.Function); ok {
+		s.depth++
+		if s.depth > s.MaxDepth {
+			s.MaxDepth = s.depth
+		}
+	}
+}
+
+func (s *Stats) leaveCall(fn object.Object) {
+	if s == nil {
+		return
+	}
+	if _, ok := fn.(*object.Function); ok {
+		s.depth--
+	}
+}
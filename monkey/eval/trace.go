@@ -0,0 +1,223 @@
+package eval
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CallRecord is one call in an execution trace. Calls are numbered in the
+// order they start, but recorded once they return, so a call's record
+// follows the records of the calls made while evaluating it.
+type CallRecord struct {
+	Seq    int          `json:"seq"`
+	Line   int          `json:"line"`
+	Call   string       `json:"call"` // the callee as written, e.g. add or compose(f, g)
+	Args   []TraceValue `json:"args"`
+	Result TraceValue   `json:"result"`
+
+	// Calls counts the calls made while this one ran, such as those of a
+	// builtin calling back into Monkey code.
+	Calls int `json:"calls,omitempty"`
+}
+
+// TraceValue is the recorded form of an object. Integers, booleans, null,
+// errors and tuples of those can be turned back into objects; anything else
+// is kept for comparison and display only.
+type TraceValue struct {
+	Type     object.ObjectType `json:"type"`
+	Value    string            `json:"value"`
+	Elements []TraceValue      `json:"elements,omitempty"`
+}
+
+func newTraceValue(obj object.Object) TraceValue {
+	if obj == nil {
+		obj = NULL
+	}
+	v := TraceValue{Type: obj.Type(), Value: obj.Inspect()}
+	if tuple, ok := obj.(*object.Tuple); ok {
+		for _, el := range tuple.Elements {
+			v.Elements = append(v.Elements, newTraceValue(el))
+		}
+	}
+	return v
+}
+
+// object turns v back into an object, reporting false for values such as
+// functions that cannot be rebuilt from a trace.
+func (v TraceValue) object() (object.Object, bool) {
+	switch v.Type {
+	case object.INTEGER_OBJ:
+		n, err := strconv.ParseInt(v.Value, 10, 64)
+		return &object.Integer{Value: n}, err == nil
+	case object.BOOLEAN_OBJ:
+		return nativeBoolToBooleanObject(v.Value == "true"), true
+	case object.NULL_OBJ:
+		return NULL, true
+	case object.ERROR_OBJ:
+		return &object.Error{Message: v.Value}, true
+	case object.TUPLE_OBJ:
+		elements := make([]object.Object, len(v.Elements))
+		for i, el := range v.Elements {
+			obj, ok := el.object()
+			if !ok {
+				return nil, false
+			}
+			elements[i] = obj
+		}
+		return &object.Tuple{Elements: elements}, true
+	default:
+		return nil, false
+	}
+}
+
+// Recorder writes a CallRecord for every call expression a program
+// evaluates, one JSON object per line. Attach it to an evaluation with
+// WithRecorder. A Recorder is not safe for concurrent use.
+type Recorder struct {
+	enc *json.Encoder
+	seq int
+	err error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error encountered while writing the trace.
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+func (r *Recorder) record(rec CallRecord) {
+	if r.err == nil {
+		r.err = r.enc.Encode(rec)
+	}
+}
+
+// Replayer feeds a trace written by a Recorder back into an evaluation.
+// Calls to builtins return their recorded results instead of running, so a
+// nondeterministic script takes the same path it took when recorded. Every
+// call is checked against the trace, and the evaluation stops with an error
+// at the first call that differs. Attach it with WithReplayer.
+type Replayer struct {
+	calls map[int]CallRecord
+	seq   int
+}
+
+// NewReplayer reads a trace written by a Recorder from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{calls: map[int]CallRecord{}}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		var rec CallRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", line, err)
+		}
+		rp.calls[rec.Seq] = rec
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+type recorderKey struct{}
+type replayerKey struct{}
+
+// WithRecorder returns a context that makes EvalContext record calls to r.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, r)
+}
+
+// WithReplayer returns a context that makes EvalContext replay calls from r.
+func WithReplayer(ctx context.Context, r *Replayer) context.Context {
+	return context.WithValue(ctx, replayerKey{}, r)
+}
+
+// applyTraced applies fn for the call expression node, recording and
+// replaying the call if ctx asks for it.
+func applyTraced(ctx context.Context, node *ast.CallExpression, fn object.Object, args []object.Object) object.Object {
+	return applyRecorded(ctx, node.Token.Line, node.Function.String(), fn, args)
+}
+
+// applyCallback applies fn on behalf of the builtin named via, such as
+// compose calling the functions it composes, recording and replaying the
+// call like a call expression. The call is recorded at the line of the
+// innermost call expression being evaluated, with the callee described as
+// e.g. "compose: <builtin double>".
+func applyCallback(ctx context.Context, via string, fn object.Object, args []object.Object) object.Object {
+	line := callStackFrom(ctx).line()
+	return applyRecorded(ctx, line, via+": "+describeCallee(fn), fn, args)
+}
+
+// describeCallee names fn, a Function or Builtin, for traces.
+func describeCallee(fn object.Object) string {
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		return "<builtin " + fn.Name + ">"
+	case *object.Function:
+		params := make([]string, len(fn.Parameters))
+		for i, p := range fn.Parameters {
+			params[i] = p.Value
+		}
+		return "fn(" + strings.Join(params, ", ") + ")"
+	}
+	return "fn"
+}
+
+// applyRecorded applies fn, recording the call, made at line to the callee
+// described by callee, if ctx has a Recorder, and replaying it if ctx has
+// a Replayer.
+func applyRecorded(ctx context.Context, line int, callee string, fn object.Object, args []object.Object) object.Object {
+	recorder, _ := ctx.Value(recorderKey{}).(*Recorder)
+	replayer, _ := ctx.Value(replayerKey{}).(*Replayer)
+	if recorder == nil && replayer == nil {
+		return applyFunction(ctx, fn, args)
+	}
+
+	call := CallRecord{Line: line, Call: callee, Args: []TraceValue{}}
+	for _, arg := range args {
+		call.Args = append(call.Args, newTraceValue(arg))
+	}
+
+	var result object.Object
+	if replayer != nil {
+		replayer.seq++
+		recorded, ok := replayer.calls[replayer.seq]
+		if !ok || recorded.Call != call.Call || !reflect.DeepEqual(recorded.Args, call.Args) {
+			return newError("replay diverged at call %d (line %d): %s", replayer.seq, call.Line, call.Call)
+		}
+		if _, isBuiltin := fn.(*object.Builtin); isBuiltin {
+			if result, ok = recorded.Result.object(); ok {
+				// The calls made inside the builtin do not happen again.
+				replayer.seq += recorded.Calls
+			}
+		}
+	}
+
+	if recorder != nil {
+		recorder.seq++
+		call.Seq = recorder.seq
+	}
+	if result == nil {
+		result = applyFunction(ctx, fn, args)
+	}
+	if recorder != nil {
+		call.Result = newTraceValue(result)
+		call.Calls = recorder.seq - call.Seq
+		recorder.record(call)
+	}
+
+	return result
+}
@@ -0,0 +1,80 @@
+// Package highlight classifies the spans of Monkey source for syntax
+// highlighting. It runs the lexer, so highlighters such as the REPL's
+// agree with the language on what every token is.
+package highlight
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+)
+
+// Class is the kind of a highlighted span.
+type Class int
+
+const (
+	Identifier Class = iota
+	Keyword
+	Number
+	String
+	Comment
+	Operator
+	Illegal
+)
+
+var classNames = [...]string{
+	Identifier: "identifier",
+	Keyword:    "keyword",
+	Number:     "number",
+	String:     "string",
+	Comment:    "comment",
+	Operator:   "operator",
+	Illegal:    "illegal",
+}
+
+func (c Class) String() string {
+	if c < 0 || int(c) >= len(classNames) {
+		return "unknown"
+	}
+	return classNames[c]
+}
+
+// Span is a classified byte range src[Start:End] of the source.
+type Span struct {
+	Start, End int
+	Class      Class
+}
+
+// Classify returns the class of tok. Delimiters count as operators, and
+// the text parts of an interpolated string as strings.
+func Classify(tok token.Token) Class {
+	switch {
+	case tok.Type == token.IDENT:
+		return Identifier
+	case tok.Type == token.INT || tok.Type == token.FLOAT:
+		return Number
+	case tok.Type == token.STRING, tok.Type == token.INTERP_START,
+		tok.Type == token.INTERP_MID, tok.Type == token.INTERP_END:
+		return String
+	case tok.Type == token.COMMENT:
+		return Comment
+	case tok.Type == token.ILLEGAL:
+		return Illegal
+	case token.IsKeyword(tok.Type):
+		return Keyword
+	}
+	return Operator
+}
+
+// Spans returns the spans of the tokens of src in order. Whitespace
+// between tokens belongs to no span.
+func Spans(src []byte) []Span {
+	l := lexer.NewBytes(src)
+	l.EmitComments(true)
+
+	var spans []Span
+	l.Tokens()(func(tok token.Token) bool {
+		spans = append(spans, Span{Start: tok.Offset, End: l.End(), Class: Classify(tok)})
+		return true
+	})
+	return spans
+}
@@ -0,0 +1,43 @@
+package highlight
+
+import "testing"
+
+func TestSpans(t *testing.T) {
+	input := "let s = \"a\\\"b\"; // note\nfn(x) { x + 0x1F } ? \"n={x}.\""
+
+	tests := []struct {
+		text  string
+		class Class
+	}{
+		{"let", Keyword},
+		{"s", Identifier},
+		{"=", Operator},
+		{`"a\"b"`, String},
+		{";", Operator},
+		{"// note", Comment},
+		{"fn", Keyword},
+		{"(", Operator},
+		{"x", Identifier},
+		{")", Operator},
+		{"{", Operator},
+		{"x", Identifier},
+		{"+", Operator},
+		{"0x1F", Number},
+		{"}", Operator},
+		{"?", Illegal},
+		{`"n={`, String},
+		{"x", Identifier},
+		{`}."`, String},
+	}
+
+	spans := Spans([]byte(input))
+	if len(spans) != len(tests) {
+		t.Fatalf("expected %d spans. got=%d: %v", len(tests), len(spans), spans)
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if text := input[span.Start:span.End]; text != tt.text || span.Class != tt.class {
+			t.Errorf("spans[%d] - expected %s %q. got=%s %q", i, tt.class, tt.text, span.Class, text)
+		}
+	}
+}
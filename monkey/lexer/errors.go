@@ -0,0 +1,40 @@
+package lexer
+
+import "fmt"
+
+// LexError describes why the lexer produced an ILLEGAL token.
+type LexError struct {
+	Char   rune // the offending character
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e LexError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Msg, e.Line, e.Column)
+}
+
+// ErrorSource is implemented by token sources that explain their ILLEGAL
+// tokens. The parser reports these errors alongside its own.
+type ErrorSource interface {
+	Errors() []LexError
+}
+
+// Errors returns an error for each ILLEGAL token lexed so far, in order,
+// including tokens lexed ahead by Peek.
+func (l *Lexer) Errors() []LexError {
+	return l.errors
+}
+
+// fail records the reason for the ILLEGAL token being scanned. The error
+// is positioned at the current character if here is set, and at the start
+// of the token otherwise, which lex fills in once the token is complete.
+func (l *Lexer) fail(here bool, format string, a ...interface{}) {
+	e := LexError{Msg: fmt.Sprintf(format, a...)}
+	if here {
+		e.Char, _ = l.currentRune()
+		e.Offset, e.Line, e.Column = l.base+l.position, l.line, l.position-l.lineStart+1
+	}
+	l.errors = append(l.errors, e)
+}
@@ -0,0 +1,60 @@
+package lexer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"monkey/token"
+	"strconv"
+)
+
+// exportedToken is the record written for each token by WriteTokensJSON.
+type exportedToken struct {
+	Type    token.TokenType `json:"type"`
+	Literal string          `json:"literal"`
+	Line    int             `json:"line"`
+	Col     int             `json:"col"`
+}
+
+// WriteTokensJSON writes the tokens of src up to, but not including, EOF
+// to w as a JSON array of objects with the fields type, literal, line and
+// col. It is meant for external tools such as syntax highlighters.
+func WriteTokensJSON(w io.Writer, src TokenSource) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i := 0; ; i++ {
+		tok := src.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n  ")
+		b, err := json.Marshal(exportedToken{tok.Type, tok.Literal, tok.Line, tok.Column})
+		if err != nil {
+			return err
+		}
+		bw.Write(b)
+	}
+	bw.WriteString("\n]\n")
+	return bw.Flush()
+}
+
+// WriteTokensCSV writes the tokens of src up to, but not including, EOF
+// to w as CSV with a header row naming the columns type, literal, line
+// and col.
+func WriteTokensCSV(w io.Writer, src TokenSource) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"type", "literal", "line", "col"})
+	for {
+		tok := src.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		cw.Write([]string{string(tok.Type), tok.Literal, strconv.Itoa(tok.Line), strconv.Itoa(tok.Column)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -1,24 +1,123 @@
+// Package lexer turns Monkey source into tokens. It is an implementation
+// package of the interpreter, without the compatibility promise of
+// package monkey.
 package lexer
 
 import (
-	"fmt"
+	"io"
 	"monkey/token"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Lexer scans a byte slice and hands out tokens on demand. Positions are
+// byte offsets into input, and columns count bytes too; literal strings are
+// only materialized for identifiers and numbers, everything else reuses
+// constant strings. Input is UTF-8, which matters only for identifiers and
+// illegal characters; everything else is ASCII.
 type Lexer struct {
-	input        string
+	input        []byte
 	position     int
 	readPosition int
 	ch           byte
+	line         int // line of ch
+	lineStart    int // offset of the first byte of line
+	names        *Names
+	comments     bool // emit COMMENT tokens instead of skipping comments
+
+	// With semicolons set, last is the type of the last token lexed,
+	// comments aside, and brackets holds the types of the brackets open
+	// after it, innermost last.
+	semicolons bool
+	last       token.TokenType
+	brackets   []token.TokenType
+
+	// peeked holds the tokens lexed ahead by PeekN, and end the end
+	// offset of the last token returned by NextToken.
+	peeked []peekedToken
+	end    int
+
+	// interp holds, for each string interpolation being lexed, from the
+	// outermost to the innermost, how many braces are open within it.
+	interp []int
+
+	// errors explains the ILLEGAL tokens lexed so far.
+	errors []LexError
+
+	// Reading from an io.Reader, input holds the unconsumed part of the
+	// stream, which starts at offset base.
+	src  io.Reader
+	base int
+	err  error
 }
 
+type peekedToken struct {
+	tok token.Token
+	end int
+}
+
+// readChunk is how much a reader-backed lexer reads at a time.
+const readChunk = 4096
+
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewBytes([]byte(input))
+}
+
+// NewBytes creates a Lexer reading directly from input without copying it.
+// The caller must not modify input while the lexer is in use.
+func NewBytes(input []byte) *Lexer {
+	l := &Lexer{input: input, line: 1, names: NewNames()}
 	l.readChar()
 	return l
 }
 
+// NewFromReader creates a Lexer reading from r as it goes, holding only
+// the part of the source that is not yet tokenized, so that piped scripts
+// and large generated programs need not be read into memory first. Token
+// offsets still count from the start of the stream. A read error ends the
+// input early and is reported by Err.
+func NewFromReader(r io.Reader) *Lexer {
+	l := &Lexer{src: r, line: 1, names: NewNames()}
+	l.readChar()
+	return l
+}
+
+// Err returns the error, other than io.EOF, that ended the input of a
+// lexer created by NewFromReader, if any.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// UseNames makes the lexer intern identifiers in n, so names can be shared
+// between lexers, e.g. across the lines of a REPL session.
+func (l *Lexer) UseNames(n *Names) {
+	l.names = n
+}
+
+// EmitComments makes the lexer return `//` line comments as COMMENT tokens,
+// for tools such as formatters and highlighters. By default comments are
+// skipped like whitespace.
+func (l *Lexer) EmitComments(on bool) {
+	l.comments = on
+}
+
+// InsertSemicolons makes the lexer end statements at line ends, as Go
+// does: a line whose last token can end a statement, such as an
+// identifier, a literal, return, ) or }, gets a SEMICOLON token with the
+// literal "\n" at its end, unless the line ends inside parentheses. As in
+// Go, an else must then follow the } before it on the same line.
+func (l *Lexer) InsertSemicolons(on bool) {
+	l.semicolons = on
+}
+
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
+	if l.readPosition >= len(l.input) {
+		l.fill(l.readPosition + 1)
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -28,65 +127,310 @@ func (l *Lexer) readChar() {
 	l.readPosition += 1
 }
 
+// fill reads from the lexer's reader, if it has one, until input holds at
+// least n bytes or the reader is exhausted.
+func (l *Lexer) fill(n int) {
+	for l.src != nil && len(l.input) < n {
+		if len(l.input) == cap(l.input) {
+			grown := make([]byte, len(l.input), 2*cap(l.input)+readChunk)
+			copy(grown, l.input)
+			l.input = grown
+		}
+		m, err := l.src.Read(l.input[len(l.input):cap(l.input)])
+		l.input = l.input[:len(l.input)+m]
+		if err != nil {
+			if err != io.EOF {
+				l.err = err
+			}
+			l.src = nil
+		}
+	}
+}
+
+// discard drops the input that has been tokenized from the buffer of a
+// reader-backed lexer once it makes up at least half of it.
+func (l *Lexer) discard() {
+	if l.src == nil || l.position < readChunk || 2*l.position < len(l.input) {
+		return
+	}
+	n := l.position
+	l.input = l.input[:copy(l.input, l.input[n:])]
+	l.base += n
+	l.position -= n
+	l.readPosition -= n
+	l.lineStart -= n
+}
+
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	if len(l.peeked) > 0 {
+		next := l.peeked[0]
+		l.peeked = l.peeked[1:]
+		l.end = next.end
+		return next.tok
+	}
+
+	tok := l.lex()
+	l.end = l.base + min(l.position, len(l.input))
+	return tok
+}
+
+// Peek returns the token the next call to NextToken will return, without
+// consuming it.
+func (l *Lexer) Peek() token.Token {
+	return l.PeekN(1)
+}
+
+// PeekN returns the nth token NextToken will return, counting from 1,
+// without consuming any. Tokens are lexed when first peeked at, so
+// changing settings such as EmitComments does not affect them afterwards.
+func (l *Lexer) PeekN(n int) token.Token {
+	for len(l.peeked) < n {
+		tok := l.lex()
+		l.peeked = append(l.peeked, peekedToken{tok: tok, end: l.base + min(l.position, len(l.input))})
+	}
+	return l.peeked[n-1].tok
+}
 
+// lex reads the next token from the input.
+func (l *Lexer) lex() token.Token {
+	l.discard()
+	if l.semicolons {
+		if tok, ok := l.lineEnd(); ok {
+			return tok
+		}
+	}
 	l.skipWhitespace()
+	for l.atComment() && !l.comments {
+		l.skipComment()
+		l.skipWhitespace()
+	}
+
+	start, line, column := l.position, l.line, l.position-l.lineStart+1
+	var tok token.Token
+	if l.atComment() {
+		end := l.skipComment()
+		tok = token.Token{Type: token.COMMENT, Literal: string(l.input[start:end])}
+	} else {
+		errs := len(l.errors)
+		tok = l.scanToken()
+		if len(l.errors) > errs && l.errors[errs].Line == 0 {
+			e := &l.errors[errs]
+			e.Char, _ = utf8.DecodeRune(l.input[start:])
+			e.Offset, e.Line, e.Column = l.base+start, line, column
+		}
+	}
+	tok.Offset, tok.Line, tok.Column = l.base+start, line, column
+
+	if l.semicolons {
+		l.track(tok.Type)
+	}
+	return tok
+}
+
+// endsStatement holds the token types after which InsertSemicolons ends a
+// statement at the end of the line.
+var endsStatement = map[token.TokenType]bool{
+	token.IDENT: true, token.INT: true, token.FLOAT: true, token.STRING: true,
+	token.INTERP_END: true, token.TRUE: true, token.FALSE: true, token.RETURN: true,
+	token.RPAREN: true, token.RBRACE: true, token.INCREMENT: true, token.DECREMENT: true,
+}
+
+// lineEnd returns the semicolon InsertSemicolons adds if only blanks or a
+// comment are left on the line of the last token and that token can end
+// a statement outside of parentheses.
+func (l *Lexer) lineEnd() (token.Token, bool) {
+	if !endsStatement[l.last] {
+		return token.Token{}, false
+	}
+	if n := len(l.brackets); n > 0 && l.brackets[n-1] != token.LBRACE {
+		return token.Token{}, false
+	}
+
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
+		l.readChar()
+	}
+	if l.ch != '\n' && !l.atComment() && l.position < len(l.input) {
+		return token.Token{}, false
+	}
+
+	l.last = token.SEMICOLON
+	return token.Token{Type: token.SEMICOLON, Literal: "\n",
+		Offset: l.base + l.position, Line: l.line, Column: l.position - l.lineStart + 1}, true
+}
+
+// track updates last and brackets for InsertSemicolons once a token of
+// type t is lexed. The expression of a string interpolation counts as
+// parenthesized.
+func (l *Lexer) track(t token.TokenType) {
+	switch t {
+	case token.COMMENT:
+		return
+	case token.LPAREN, token.LBRACE:
+		l.brackets = append(l.brackets, t)
+	case token.INTERP_START:
+		l.brackets = append(l.brackets, token.LPAREN)
+	case token.RPAREN, token.RBRACE, token.INTERP_END:
+		if n := len(l.brackets); n > 0 {
+			l.brackets = l.brackets[:n-1]
+		}
+	}
+	l.last = t
+}
+
+// End returns the offset just past the last token returned by NextToken,
+// so that the token spans input[tok.Offset:l.End()].
+func (l *Lexer) End() int {
+	return l.end
+}
+
+// Tokens returns an iterator over the remaining tokens, up to but not
+// including EOF, for tools that walk every token. It stops early when
+// yield returns false. It has the shape of iter.Seq[token.Token], so it
+// can be ranged over once the module requires Go 1.23; until then it is
+// called with the loop body:
+//
+//	l.Tokens()(func(tok token.Token) bool {
+//		fmt.Println(tok.Type)
+//		return true
+//	})
+func (l *Lexer) Tokens() func(yield func(token.Token) bool) {
+	return func(yield func(token.Token) bool) {
+		for {
+			tok := l.NextToken()
+			if tok.Type == token.EOF || !yield(tok) {
+				return
+			}
+		}
+	}
+}
+
+// scanToken reads the token starting at the current character.
+func (l *Lexer) scanToken() token.Token {
+	var tok token.Token
+	start := l.position
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			tok = token.Token{Type: token.EQ, Literal: "=="}
+			tok = token.Token{Type: token.EQ, Literal: token.EQ}
 			l.readChar()
 		} else {
-			tok = newToken(token.ASSIGN, l.ch)
+			tok = newToken(token.ASSIGN)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '+' {
+			tok = token.Token{Type: token.INCREMENT, Literal: token.INCREMENT}
+			l.readChar()
+		} else {
+			tok = l.withAssign(token.PLUS, token.PLUS_ASSIGN)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '-' {
+			tok = token.Token{Type: token.DECREMENT, Literal: token.DECREMENT}
+			l.readChar()
+		} else {
+			tok = l.withAssign(token.MINUS, token.MINUS_ASSIGN)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			tok = token.Token{Type: token.NOT_EQ, Literal: "!="}
+			tok = token.Token{Type: token.NOT_EQ, Literal: token.NOT_EQ}
 			l.readChar()
 		} else {
-			tok = newToken(token.BANG, l.ch)
+			tok = newToken(token.BANG)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		tok = l.withAssign(token.ASTERISK, token.ASTERISK_ASSIGN)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		tok = l.withAssign(token.SLASH, token.SLASH_ASSIGN)
+	case '%':
+		tok = newToken(token.PERCENT)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.LT_EQ, Literal: token.LT_EQ}
+			l.readChar()
+		} else if l.peekChar() == '<' {
+			tok = token.Token{Type: token.SHIFT_LEFT, Literal: token.SHIFT_LEFT}
+			l.readChar()
+		} else {
+			tok = newToken(token.LT)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = token.Token{Type: token.GT_EQ, Literal: token.GT_EQ}
+			l.readChar()
+		} else if l.peekChar() == '>' {
+			tok = token.Token{Type: token.SHIFT_RIGHT, Literal: token.SHIFT_RIGHT}
+			l.readChar()
+		} else {
+			tok = newToken(token.GT)
+		}
+	case '^':
+		tok = newToken(token.CARET)
+	case '~':
+		tok = newToken(token.TILDE)
+	case '&':
+		if l.peekChar() == '&' {
+			tok = token.Token{Type: token.AND, Literal: token.AND}
+			l.readChar()
+		} else {
+			tok = newToken(token.AMPERSAND)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = token.Token{Type: token.OR, Literal: token.OR}
+			l.readChar()
+		} else {
+			tok = newToken(token.PIPE)
+		}
 	case ',':
-		tok = newToken(token.COMMA, l.ch)
+		tok = newToken(token.COMMA)
 	case ';':
-		tok = newToken(token.SEMICOLON, l.ch)
+		tok = newToken(token.SEMICOLON)
 	case '(':
-		tok = newToken(token.LPAREN, l.ch)
+		tok = newToken(token.LPAREN)
 	case ')':
-		tok = newToken(token.RPAREN, l.ch)
+		tok = newToken(token.RPAREN)
 	case '{':
-		tok = newToken(token.LBRACE, l.ch)
+		if n := len(l.interp); n > 0 {
+			l.interp[n-1]++
+		}
+		tok = newToken(token.LBRACE)
 	case '}':
-		tok = newToken(token.RBRACE, l.ch)
+		if n := len(l.interp); n > 0 {
+			if l.interp[n-1] == 0 {
+				l.interp = l.interp[:n-1]
+				return l.readString(true)
+			}
+			l.interp[n-1]--
+		}
+		tok = newToken(token.RBRACE)
+	case '"':
+		return l.readString(false)
+	case '`':
+		return l.readRawString()
 	case '\000':
 		tok.Type = token.EOF
 		tok.Literal = ""
 	default:
-		if isLetter(l.ch) {
-			tok.Literal = l.readIdentifier()
-			tok.Type = token.LookupIdent(tok.Literal)
+		r, size := l.currentRune()
+		if isLetter(r) {
+			end := l.readIdentifier()
+			tok.Type, tok.Literal = l.lookupIdent(l.input[start:end])
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Literal = l.readNumber()
+			end, isFloat := l.readNumber()
+			tok.Literal = string(l.input[start:end])
 			tok.Type = token.INT
+			if isFloat {
+				tok.Type = token.FLOAT
+			}
 			return tok
 		} else {
-			fmt.Print(l.ch)
-			tok = newToken(token.ILLEGAL, l.ch)
+			l.fail(false, "illegal character %q", r)
+			for i := 0; i < size; i++ {
+				l.readChar()
+			}
+			return token.Token{Type: token.ILLEGAL, Literal: string(l.input[start:l.position])}
 		}
 	}
 
@@ -94,41 +438,242 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
-	return token.Token{Type: tokenType, Literal: string(ch)}
+// newToken builds a token for a fixed operator or delimiter, whose literal
+// is the token type itself, so no string is allocated.
+func newToken(tokenType token.TokenType) token.Token {
+	return token.Token{Type: tokenType, Literal: string(tokenType)}
+}
+
+// withAssign returns a compound assignment token such as += if the current
+// operator is followed by '=', and the plain operator otherwise.
+func (l *Lexer) withAssign(op, compound token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		l.readChar()
+		return newToken(compound)
+	}
+	return newToken(op)
+}
+
+// lookupIdent resolves ident to a keyword or identifier token type. Keywords
+// reuse the keyword table's string; plain identifiers are interned.
+func (l *Lexer) lookupIdent(ident []byte) (token.TokenType, string) {
+	if tok, lit, ok := token.LookupKeyword(ident); ok {
+		return tok, lit
+	}
+	return token.IDENT, l.names.Intern(ident)
 }
 
-func (l *Lexer) readIdentifier() string {
-	position := l.position
-	for isLetter(l.ch) {
+// readString reads a double-quoted string starting at the current
+// character. The token's literal is the string's value, with the escapes
+// \n, \t, \", \\ and \{ resolved. An unterminated string or an unknown
+// escape yields an ILLEGAL token holding the source text read so far.
+//
+// An unescaped { starts an interpolated expression, which ends the string
+// part with an INTERP_START token; the matching } resumes the string,
+// which is read with resumed set, and yields INTERP_MID or INTERP_END.
+func (l *Lexer) readString(resumed bool) token.Token {
+	start := l.position
+	var value []byte // only used once an escape is seen
+	part := func(typ token.TokenType) token.Token {
+		if value == nil {
+			return token.Token{Type: typ, Literal: string(l.input[start+1 : l.position-1])}
+		}
+		return token.Token{Type: typ, Literal: string(value)}
+	}
+
+	for {
 		l.readChar()
+		switch l.ch {
+		case '"':
+			l.readChar()
+			if resumed {
+				return part(token.INTERP_END)
+			}
+			return part(token.STRING)
+		case '{':
+			l.readChar()
+			l.interp = append(l.interp, 0)
+			if resumed {
+				return part(token.INTERP_MID)
+			}
+			return part(token.INTERP_START)
+		case 0:
+			if l.position >= len(l.input) {
+				l.fail(false, "unterminated string")
+				return token.Token{Type: token.ILLEGAL, Literal: string(l.input[start:])}
+			}
+		case '\\':
+			if value == nil {
+				value = append([]byte{}, l.input[start+1:l.position]...)
+			}
+			l.readChar()
+			escaped, ok := escapes[l.ch]
+			if !ok {
+				if l.position >= len(l.input) {
+					l.fail(false, "unterminated string")
+				} else {
+					r, _ := l.currentRune()
+					l.fail(true, "unknown escape sequence \\%c", r)
+				}
+				l.readChar()
+				return token.Token{Type: token.ILLEGAL, Literal: string(l.input[start:min(l.position, len(l.input))])}
+			}
+			value = append(value, escaped)
+			continue
+		}
+		if value != nil {
+			value = append(value, l.ch)
+		}
 	}
-	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readRawString reads a backtick-quoted string, whose content is taken
+// verbatim: it may span lines and has no escapes. An unterminated raw
+// string yields an ILLEGAL token holding the rest of the input.
+func (l *Lexer) readRawString() token.Token {
+	start := l.position
+	for {
+		l.readChar()
+		if l.ch == '`' {
+			l.readChar()
+			return token.Token{Type: token.STRING, Literal: string(l.input[start+1 : l.position-1])}
+		}
+		if l.ch == 0 && l.position >= len(l.input) {
+			l.fail(false, "unterminated raw string")
+			return token.Token{Type: token.ILLEGAL, Literal: string(l.input[start:])}
+		}
+	}
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
+var escapes = map[byte]byte{'n': '\n', 't': '\t', '"': '"', '\\': '\\', '{': '{'}
+
+// readIdentifier reads an identifier: a letter or underscore followed by
+// any number of letters, digits and underscores, from all of Unicode.
+func (l *Lexer) readIdentifier() int {
+	for {
+		r, size := l.currentRune()
+		if !isLetter(r) && !unicode.IsDigit(r) {
+			return l.position
+		}
+		for i := 0; i < size; i++ {
+			l.readChar()
+		}
+	}
+}
+
+func isLetter(r rune) bool {
+	if r < utf8.RuneSelf {
+		return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+	}
+	return unicode.IsLetter(r)
+}
+
+// currentRune decodes the character starting at the current byte and
+// returns it with its length in bytes. Invalid UTF-8 decodes as
+// utf8.RuneError of length 1.
+func (l *Lexer) currentRune() (rune, int) {
+	if l.ch < utf8.RuneSelf {
+		return rune(l.ch), 1
+	}
+	l.fill(l.position + utf8.UTFMax)
+	return utf8.DecodeRune(l.input[l.position:])
+}
+
+// readNumber reads an integer or a decimal literal such as 12.75 or
+// 2.5e-3 and returns its end offset. A dot or exponent only belongs to the
+// number if a digit follows it, so `1.` is the integer 1 followed by a dot
+// and `1e` is 1 followed by the identifier e. Integers may
+// also be written in hex, octal or binary, as in 0x1F, 0o755 and 0b1010;
+// the digits of those are checked by the parser, so 0b12 is one literal
+// rather than 0b1 followed by 2.
+func (l *Lexer) readNumber() (end int, isFloat bool) {
+	if l.ch == '0' && radixPrefixes[l.peekChar()] {
+		l.readChar()
+		l.readChar()
+		for isHexDigit(l.ch) {
+			l.readChar()
+		}
+		return l.position, false
+	}
+
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		isFloat = true
+		l.readChar()
+		for isDigit(l.ch) {
+			l.readChar()
+		}
+	}
+	if l.ch == 'e' || l.ch == 'E' {
+		digits := 1 // offset of the exponent's first digit from l.ch
+		if sign := l.peekChar(); sign == '+' || sign == '-' {
+			digits = 2
+		}
+		if isDigit(l.peekCharAt(digits - 1)) {
+			isFloat = true
+			for i := 0; i < digits; i++ {
+				l.readChar()
+			}
+			for isDigit(l.ch) {
+				l.readChar()
+			}
+		}
+	}
+	return l.position, isFloat
 }
 
+var radixPrefixes = map[byte]bool{'x': true, 'X': true, 'o': true, 'O': true, 'b': true, 'B': true}
+
 func isDigit(ch byte) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+func isHexDigit(ch byte) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
 	}
 }
 
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && l.peekChar() == '/' || l.atShebang()
+}
+
+// atShebang reports whether the lexer is at a `#!` line starting the input,
+// as in executable scripts, which is treated as a comment.
+func (l *Lexer) atShebang() bool {
+	return l.base+l.position == 0 && l.ch == '#' && l.peekChar() == '!'
+}
+
+// skipComment skips a line comment up to, but not including, the newline
+// and returns the comment's end offset.
+func (l *Lexer) skipComment() int {
+	for l.ch != '\n' && l.position < len(l.input) {
+		l.readChar()
+	}
+	return min(l.position, len(l.input))
+}
+
+// peekCharAt returns the byte n positions after the one peekChar returns.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPosition+n >= len(l.input) {
+		l.fill(l.readPosition + n + 1)
+	}
+	if l.readPosition+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPosition+n]
+}
+
 func (l *Lexer) peekChar() byte {
+	if l.readPosition >= len(l.input) {
+		l.fill(l.readPosition + 1)
+	}
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
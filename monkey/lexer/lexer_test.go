@@ -1,7 +1,14 @@
 package lexer
 
 import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"unsafe"
 
 	"monkey/token"
 )
@@ -26,6 +33,12 @@ if (5 < 10) {
 
 10 == 10;
 10 != 9;
+10 <= 11 >= 9 < =;
+a && b || !c & |;
+15 % 4;
+~a ^ b << 2 >> 1 <<= >>=;
+a += 1; a -= 2; a *= 3; a /= 4; a + = 5;
+a++; b--; - -c; ++-;
 `
 
 	tests := []struct {
@@ -105,6 +118,74 @@ if (5 < 10) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.INT, "10"},
+		{token.LT_EQ, "<="},
+		{token.INT, "11"},
+		{token.GT_EQ, ">="},
+		{token.INT, "9"},
+		{token.LT, "<"},
+		{token.ASSIGN, "="},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.SEMICOLON, ";"},
+		{token.INT, "15"},
+		{token.PERCENT, "%"},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.TILDE, "~"},
+		{token.IDENT, "a"},
+		{token.CARET, "^"},
+		{token.IDENT, "b"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.INT, "2"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.INT, "1"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.ASSIGN, "="},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.ASSIGN, "="},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PLUS, "+"},
+		{token.ASSIGN, "="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.INCREMENT, "++"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "b"},
+		{token.DECREMENT, "--"},
+		{token.SEMICOLON, ";"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.INCREMENT, "++"},
+		{token.MINUS, "-"},
+		{token.SEMICOLON, ";"},
 		{token.EOF, ""},
 	}
 
@@ -124,3 +205,572 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"hello world"`, token.STRING, "hello world"},
+		{`""`, token.STRING, ""},
+		{`"a\nb\tc"`, token.STRING, "a\nb\tc"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{"\"two\nlines\"", token.STRING, "two\nlines"},
+		{`"unterminated`, token.ILLEGAL, `"unterminated`},
+		{`"ends in \"`, token.ILLEGAL, `"ends in \"`},
+		{`"bad \q escape"`, token.ILLEGAL, `"bad \q`},
+		{`"trailing \`, token.ILLEGAL, `"trailing \`},
+		{"`raw \\d+\\n\"q\"`", token.STRING, `raw \d+\n"q"`},
+		{"`two\nlines`", token.STRING, "two\nlines"},
+		{"``", token.STRING, ""},
+		{"`unterminated", token.ILLEGAL, "`unterminated"},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%s: expected %s %q. got=%s %q",
+				tt.input, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	l := New(`let s = "a\"b"; s`)
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.STRING,
+		token.SEMICOLON, token.IDENT, token.EOF}
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("tokens[%d] - expected %s. got=%s (%q)", i, want, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := "let café = größe_2 + π;\nnaïve→x €"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		offset, column  int
+	}{
+		{token.LET, "let", 0, 1},
+		{token.IDENT, "café", 4, 5},
+		{token.ASSIGN, "=", 10, 11},
+		{token.IDENT, "größe_2", 12, 13},
+		{token.PLUS, "+", 22, 23},
+		{token.IDENT, "π", 24, 25},
+		{token.SEMICOLON, ";", 26, 27},
+		{token.IDENT, "naïve", 28, 1},
+		{token.ILLEGAL, "→", 34, 7},
+		{token.IDENT, "x", 37, 10},
+		{token.ILLEGAL, "€", 39, 12},
+		{token.EOF, "", 42, 15},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q. got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Offset != tt.offset || tok.Column != tt.column {
+			t.Fatalf("tests[%d] - position of %q wrong, expected=%d (column %d), got=%d (column %d)",
+				i, tok.Literal, tt.offset, tt.column, tok.Offset, tok.Column)
+		}
+	}
+
+	if tok := New("\xff").NextToken(); tok.Type != token.ILLEGAL || tok.Literal != "\xff" {
+		t.Errorf("invalid UTF-8: expected ILLEGAL %q. got=%s %q", "\xff", tok.Type, tok.Literal)
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"sum is {x + y}!" "{f(fn() { "{1}" })}\{x} {}" "a{`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INTERP_START, "sum is "},
+		{token.IDENT, "x"},
+		{token.PLUS, "+"},
+		{token.IDENT, "y"},
+		{token.INTERP_END, "!"},
+		{token.INTERP_START, ""},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.INTERP_START, ""},
+		{token.INT, "1"},
+		{token.INTERP_END, ""},
+		{token.RBRACE, "}"},
+		{token.RPAREN, ")"},
+		{token.INTERP_MID, "{x} "},
+		{token.INTERP_END, ""},
+		{token.INTERP_START, "a"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q. got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+
+	l = New(`"{x" } y`)
+	for _, expected := range []token.TokenType{token.INTERP_START, token.IDENT, token.ILLEGAL, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("unterminated interpolation: expected %s. got=%s %q", expected, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := "0.5 12.75 3.14159 42 007 1.5.2 1. x.5 0x1F 0o755 0b1010 0b12 0xG 1e9 2.5e-3 1E+6 1e 1e+ 2.0E5x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "0.5"},
+		{token.FLOAT, "12.75"},
+		{token.FLOAT, "3.14159"},
+		{token.INT, "42"},
+		{token.INT, "007"},
+		{token.FLOAT, "1.5"},
+		{token.ILLEGAL, "."},
+		{token.INT, "2"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "x"},
+		{token.ILLEGAL, "."},
+		{token.INT, "5"},
+		{token.INT, "0x1F"},
+		{token.INT, "0o755"},
+		{token.INT, "0b1010"},
+		{token.INT, "0b12"},
+		{token.INT, "0x"},
+		{token.IDENT, "G"},
+		{token.FLOAT, "1e9"},
+		{token.FLOAT, "2.5e-3"},
+		{token.FLOAT, "1E+6"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.PLUS, "+"},
+		{token.FLOAT, "2.0E5"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %s %q. got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading comment
+let x = 5; // trailing comment
+// two
+// in a row
+x / 2 //`
+
+	skipped := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.EOF}
+	l := New(input)
+	for i, want := range skipped {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("skipped[%d] - expected %s. got=%s (%q)", i, want, tok.Type, tok.Literal)
+		}
+	}
+
+	emitted := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		line, column    int
+	}{
+		{token.COMMENT, "// leading comment", 1, 1},
+		{token.LET, "let", 2, 1},
+		{token.IDENT, "x", 2, 5},
+		{token.ASSIGN, "=", 2, 7},
+		{token.INT, "5", 2, 9},
+		{token.SEMICOLON, ";", 2, 10},
+		{token.COMMENT, "// trailing comment", 2, 12},
+		{token.COMMENT, "// two", 3, 1},
+		{token.COMMENT, "// in a row", 4, 1},
+		{token.IDENT, "x", 5, 1},
+		{token.SLASH, "/", 5, 3},
+		{token.INT, "2", 5, 5},
+		{token.COMMENT, "//", 5, 7},
+		{token.EOF, "", 5, 9},
+	}
+	l = New(input)
+	l.EmitComments(true)
+	for i, tt := range emitted {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral || tok.Line != tt.line || tok.Column != tt.column {
+			t.Fatalf("emitted[%d] - expected %s %q at %d:%d. got=%s %q at %d:%d", i,
+				tt.expectedType, tt.expectedLiteral, tt.line, tt.column, tok.Type, tok.Literal, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 10;\n  x == 5"
+
+	tests := []struct {
+		offset, line, column int
+	}{
+		{0, 1, 1},
+		{4, 1, 5},
+		{6, 1, 7},
+		{8, 1, 9},
+		{10, 1, 11},
+		{14, 2, 3},
+		{16, 2, 5},
+		{19, 2, 8},
+		{20, 2, 9},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Offset != tt.offset || tok.Line != tt.line || tok.Column != tt.column {
+			t.Fatalf("tests[%d] - position of %q wrong, expected=%d (%d:%d), got=%d (%d:%d)",
+				i, tok.Literal, tt.offset, tt.line, tt.column, tok.Offset, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestInternedIdentifiers(t *testing.T) {
+	names := NewNames()
+	first, second := New("foo bar"), New("foo let")
+	first.UseNames(names)
+	second.UseNames(names)
+
+	foo := first.NextToken().Literal
+	first.NextToken()
+	again := second.NextToken().Literal
+	second.NextToken()
+
+	if foo != "foo" || again != "foo" {
+		t.Fatalf("wrong literals. got=%q, %q", foo, again)
+	}
+	if unsafe.StringData(foo) != unsafe.StringData(again) {
+		t.Errorf("identifier foo was not interned")
+	}
+	if names.Len() != 2 {
+		t.Errorf("expected 2 interned names, keywords excluded. got=%d", names.Len())
+	}
+}
+
+func TestRegisterKeyword(t *testing.T) {
+	defer token.RestoreKeywords(token.SnapshotKeywords())
+
+	const WHILE = token.TokenType("WHILE")
+	if err := token.RegisterKeyword("while", WHILE); err != nil {
+		t.Fatalf("RegisterKeyword: %v", err)
+	}
+	if err := token.RegisterKeyword("while", "LOOP"); err == nil {
+		t.Errorf("expected an error registering while twice")
+	}
+	if err := token.RegisterKeyword("loop", token.LET); err == nil {
+		t.Errorf("expected an error reusing the token type of let")
+	}
+
+	tok := New("while").NextToken()
+	if tok.Type != WHILE || tok.Literal != "while" || !token.IsKeyword(WHILE) {
+		t.Fatalf("expected the keyword while. got=%+v", tok)
+	}
+
+	token.ResetKeywords()
+	if tok := New("while").NextToken(); tok.Type != token.IDENT {
+		t.Fatalf("expected while to be an identifier after ResetKeywords. got=%s", tok.Type)
+	}
+	if tok := New("let").NextToken(); tok.Type != token.LET {
+		t.Fatalf("expected let to stay a keyword. got=%s", tok.Type)
+	}
+}
+
+func TestShebang(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1; # !"
+
+	l := New(input)
+	tok := l.NextToken()
+	if tok.Type != token.LET || tok.Line != 2 || tok.Column != 1 {
+		t.Fatalf("expected let at line 2, column 1. got=%+v", tok)
+	}
+	for tok.Type != token.EOF {
+		tok = l.NextToken()
+	}
+	if errs := l.Errors(); len(errs) != 1 || errs[0].Char != '#' {
+		t.Errorf("expected # to be illegal after the first line. got=%v", errs)
+	}
+
+	l = NewFromReader(strings.NewReader(input))
+	l.EmitComments(true)
+	if tok := l.NextToken(); tok.Type != token.COMMENT || tok.Literal != "#!/usr/bin/env monkey" {
+		t.Errorf("expected the shebang line as a comment. got=%+v", tok)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	var types []token.TokenType
+	New("let x = 5;").Tokens()(func(tok token.Token) bool {
+		types = append(types, tok.Type)
+		return true
+	})
+	expected := []token.TokenType{token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("expected %v. got=%v", expected, types)
+	}
+
+	l := New("a b c")
+	l.Tokens()(func(tok token.Token) bool {
+		return tok.Literal != "b"
+	})
+	if tok := l.NextToken(); tok.Literal != "c" {
+		t.Errorf("expected the iterator to stop after b. got=%q", tok.Literal)
+	}
+}
+
+func TestInsertSemicolons(t *testing.T) {
+	input := `let add = fn(a,
+    b) {
+  return a + b // sum
+}
+add(1, 2)
+`
+	l := New(input)
+	l.InsertSemicolons(true)
+
+	var got []string
+	l.Tokens()(func(tok token.Token) bool {
+		got = append(got, tok.Literal)
+		return true
+	})
+	expected := []string{"let", "add", "=", "fn", "(", "a", ",", "b", ")", "{",
+		"return", "a", "+", "b", "\n", "}", "\n", "add", "(", "1", ",", "2", ")", "\n"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q. got=%q", expected, got)
+	}
+
+	l = New("x\ny")
+	if tok := l.PeekN(2); tok.Type != token.IDENT {
+		t.Errorf("expected no semicolons by default. got=%s", tok.Type)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	input := "let x = 5; // done"
+	l := New(input)
+	l.EmitComments(true)
+
+	if tok := l.Peek(); tok.Type != token.LET {
+		t.Fatalf("Peek: expected LET. got=%s", tok.Type)
+	}
+	if tok := l.PeekN(3); tok.Type != token.ASSIGN || tok.Column != 7 {
+		t.Fatalf("PeekN(3): expected = at column 7. got=%s at %d", tok.Type, tok.Column)
+	}
+	if tok := l.PeekN(10); tok.Type != token.EOF {
+		t.Fatalf("PeekN(10): expected EOF. got=%s", tok.Type)
+	}
+
+	want := New(input)
+	want.EmitComments(true)
+	for i := 0; ; i++ {
+		if i%2 == 0 {
+			l.PeekN(2)
+		}
+		expected, tok := want.NextToken(), l.NextToken()
+		if tok != expected {
+			t.Fatalf("tokens[%d] - expected %+v. got=%+v", i, expected, tok)
+		}
+		if l.End() != want.End() {
+			t.Fatalf("tokens[%d] - expected end %d. got=%d", i, want.End(), l.End())
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	input := "let a = 1 @ 2;\nlet é = \"x\\q\n`open"
+
+	l := New(input)
+	for l.NextToken().Type != token.EOF {
+	}
+
+	expected := []LexError{
+		{Char: '@', Offset: 10, Line: 1, Column: 11, Msg: "illegal character '@'"},
+		{Char: 'q', Offset: 27, Line: 2, Column: 13, Msg: `unknown escape sequence \q`},
+		{Char: '`', Offset: 29, Line: 3, Column: 1, Msg: "unterminated raw string"},
+	}
+	errs := l.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors. got=%d: %v", len(expected), len(errs), errs)
+	}
+	for i, e := range expected {
+		if errs[i] != e {
+			t.Errorf("errors[%d] - expected %+v. got=%+v", i, e, errs[i])
+		}
+	}
+	if msg := errs[0].Error(); msg != "illegal character '@' at line 1, column 11" {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
+
+func TestTokenStream(t *testing.T) {
+	s := NewTokenStream(New("a b c d e"))
+
+	expect := func(want string) {
+		t.Helper()
+		if tok := s.NextToken(); tok.Literal != want {
+			t.Fatalf("expected %q. got=%q", want, tok.Literal)
+		}
+	}
+
+	expect("a")
+
+	s.Mark()
+	expect("b")
+	expect("c")
+	s.Reset()
+	expect("b")
+
+	s.Mark()
+	expect("c")
+	s.Mark()
+	expect("d")
+	s.Reset()
+	expect("d")
+	s.Release()
+	expect("e")
+
+	s.Mark()
+	expect("")
+	expect("")
+	s.Reset()
+	expect("")
+	expect("")
+
+	if len(s.buf) != 0 {
+		t.Errorf("buffer not released once all marks are gone. len=%d", len(s.buf))
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	src := strings.Repeat("let café = fn(x) { \"s\\t\" + 0x1F; }; // c\n", 500)
+
+	want := New(src)
+	want.EmitComments(true)
+	l := NewFromReader(iotest.OneByteReader(strings.NewReader(src)))
+	l.EmitComments(true)
+	for i := 0; ; i++ {
+		expected, tok := want.NextToken(), l.NextToken()
+		if tok != expected {
+			t.Fatalf("tokens[%d] - expected %+v. got=%+v", i, expected, tok)
+		}
+		if l.End() != want.End() {
+			t.Fatalf("tokens[%d] - expected end %d. got=%d", i, want.End(), l.End())
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if cap(l.input) >= len(src) {
+		t.Errorf("lexer buffered the whole input: cap=%d", cap(l.input))
+	}
+	if l.Err() != nil {
+		t.Errorf("unexpected error: %v", l.Err())
+	}
+
+	boom := errors.New("boom")
+	l = NewFromReader(io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(boom)))
+	for _, expected := range []token.TokenType{token.LET, token.IDENT, token.EOF} {
+		if tok := l.NextToken(); tok.Type != expected {
+			t.Fatalf("expected %s. got=%s", expected, tok.Type)
+		}
+	}
+	if l.Err() != boom {
+		t.Errorf("expected error %v. got=%v", boom, l.Err())
+	}
+}
+
+func BenchmarkLexer(b *testing.B) {
+	src := []byte(strings.Repeat(`let add = fn(x, y) {
+  if (x < y) { return x + y; } else { return x * y; }
+};
+let result = add(five, 10) != 9 == true;
+`, 1000))
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		l := NewBytes(src)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func TestWriteTokens(t *testing.T) {
+	input := "let s = \"a,\\\"b\"; // done"
+
+	tests := []struct {
+		write    func(io.Writer, TokenSource) error
+		expected string
+	}{
+		{WriteTokensJSON, `[
+  {"type":"LET","literal":"let","line":1,"col":1},
+  {"type":"IDENT","literal":"s","line":1,"col":5},
+  {"type":"=","literal":"=","line":1,"col":7},
+  {"type":"STRING","literal":"a,\"b","line":1,"col":9},
+  {"type":";","literal":";","line":1,"col":16},
+  {"type":"COMMENT","literal":"// done","line":1,"col":18}
+]
+`},
+		{WriteTokensCSV, `type,literal,line,col
+LET,let,1,1
+IDENT,s,1,5
+=,=,1,7
+STRING,"a,""b",1,9
+;,;,1,16
+COMMENT,// done,1,18
+`},
+	}
+
+	for i, tt := range tests {
+		l := New(input)
+		l.EmitComments(true)
+		var out bytes.Buffer
+		if err := tt.write(&out, l); err != nil {
+			t.Fatalf("tests[%d] - unexpected error: %v", i, err)
+		}
+		if out.String() != tt.expected {
+			t.Errorf("tests[%d] - expected:\n%s\ngot:\n%s", i, tt.expected, out.String())
+		}
+	}
+
+	var out bytes.Buffer
+	WriteTokensJSON(&out, New(""))
+	if out.String() != "[\n]\n" {
+		t.Errorf("empty input: got %q", out.String())
+	}
+}
@@ -0,0 +1,28 @@
+package lexer
+
+// Names is a string table for identifier names. Every occurrence of a name
+// read through the same table shares one string, so the AST and environments
+// keep a single copy per name and map lookups on equal names compare
+// identical pointers. A Names is not safe for concurrent use.
+type Names struct {
+	table map[string]string
+}
+
+func NewNames() *Names {
+	return &Names{table: make(map[string]string)}
+}
+
+// Intern returns the canonical string for name, copying it on first use.
+func (n *Names) Intern(name []byte) string {
+	if s, ok := n.table[string(name)]; ok {
+		return s
+	}
+	s := string(name)
+	n.table[s] = s
+	return s
+}
+
+// Len returns the number of distinct names in the table.
+func (n *Names) Len() int {
+	return len(n.table)
+}
@@ -0,0 +1,78 @@
+package lexer
+
+import "monkey/token"
+
+// TokenSource produces tokens one at a time, ending with an endless run of
+// EOF tokens. Lexer and TokenStream are token sources.
+type TokenSource interface {
+	NextToken() token.Token
+}
+
+// TokenStream buffers the tokens of a source so that a consumer can parse
+// ahead speculatively and then backtrack. Mark records the current position;
+// Reset rewinds to the most recent mark and Release keeps the tokens read
+// since then. Marks nest, so each Mark must be matched by exactly one Reset
+// or Release, innermost first.
+type TokenStream struct {
+	src   TokenSource
+	buf   []token.Token
+	pos   int   // index into buf of the next token to hand out
+	marks []int // positions recorded by Mark, innermost last
+}
+
+func NewTokenStream(src TokenSource) *TokenStream {
+	return &TokenStream{src: src}
+}
+
+func (s *TokenStream) NextToken() token.Token {
+	if s.pos < len(s.buf) {
+		tok := s.buf[s.pos]
+		s.pos++
+		s.compact()
+		return tok
+	}
+
+	tok := s.src.NextToken()
+	if len(s.marks) > 0 {
+		s.buf = append(s.buf, tok)
+		s.pos++
+	}
+	return tok
+}
+
+// Errors returns the errors of the underlying source, if it reports any.
+func (s *TokenStream) Errors() []LexError {
+	if src, ok := s.src.(ErrorSource); ok {
+		return src.Errors()
+	}
+	return nil
+}
+
+// Mark records the current position for a later Reset or Release.
+func (s *TokenStream) Mark() {
+	s.marks = append(s.marks, s.pos)
+}
+
+// Reset rewinds the stream to the most recent mark and removes that mark.
+func (s *TokenStream) Reset() {
+	last := len(s.marks) - 1
+	s.pos = s.marks[last]
+	s.marks = s.marks[:last]
+}
+
+// Release removes the most recent mark without moving the stream, keeping
+// every token consumed since it.
+func (s *TokenStream) Release() {
+	s.marks = s.marks[:len(s.marks)-1]
+	s.compact()
+}
+
+// compact drops buffered tokens once no mark can rewind to them anymore.
+func (s *TokenStream) compact() {
+	if len(s.marks) > 0 || s.pos == 0 {
+		return
+	}
+	n := copy(s.buf, s.buf[s.pos:])
+	s.buf = s.buf[:n]
+	s.pos = 0
+}
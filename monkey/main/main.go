@@ -1,18 +1,177 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
 	"monkey/repl"
+	"monkey/transpile"
+	"net"
 	"os"
 	"os/user"
+	"text/tabwriter"
+	"time"
 )
 
+// commands are the subcommands of monkey, run with the arguments that
+// follow the subcommand's name. Without one, monkey starts the REPL.
+var commands = map[string]func(args []string) error{
+	"explain":    explain,
+	"run":        run,
+	"serve-repl": serveREPL,
+	"tokens":     tokens,
+	"transpile":  transpileProgram,
+}
+
 func main() {
+	grammar := flag.Bool("grammar", false, "print the operator precedence table and exit")
+	semicolons := flag.Bool("semicolons", false, "end statements at line ends in the REPL, as Go does")
+	flag.Parse()
+
+	if *grammar {
+		printGrammar(os.Stdout)
+		return
+	}
+
+	if args := flag.Args(); len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			if err := cmd(args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "monkey %s: %v\n", args[0], err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		// `monkey script.monkey args...` runs the script, which is how
+		// a script starting with `#!/usr/bin/env monkey` is executed.
+		if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+			if err := run(args); err != nil {
+				fmt.Fprintf(os.Stderr, "monkey: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
 	}
 	fmt.Printf("Hello %s!. This is the Monkey programming language!\n", user.Username)
 	fmt.Printf("Feel free to type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
+	r := repl.New(os.Stdin, os.Stdout)
+	r.Signals = true
+	r.Semicolons = *semicolons
+	r.Run()
+}
+
+// serveREPL implements `monkey serve-repl`, which serves REPL sessions on
+// a TCP address. Clients must first send the token given by --token or
+// the MONKEY_REPL_TOKEN environment variable.
+func serveREPL(args []string) error {
+	fs := flag.NewFlagSet("serve-repl", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:7000", "address to listen on")
+	token := fs.String("token", os.Getenv("MONKEY_REPL_TOKEN"), "token clients must send before their session starts")
+	timeout := fs.Duration("timeout", 5*time.Second, "limit on each evaluation, 0 for none")
+	fs.Parse(args)
+
+	if *token == "" {
+		return fmt.Errorf("no token: set --token or MONKEY_REPL_TOKEN")
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "serving the Monkey REPL on %s\n", ln.Addr())
+
+	s := &repl.Server{Token: *token, Timeout: *timeout}
+	return s.Serve(ln)
+}
+
+// tokens implements `monkey tokens [--format json|csv] file.monkey`, which
+// writes the tokens of a file, comments included, to standard output.
+func tokens(args []string) error {
+	fs := flag.NewFlagSet("tokens", flag.ExitOnError)
+	format := fs.String("format", "json", "output format, json or csv")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: monkey tokens [--format json|csv] file.monkey")
+	}
+	write, ok := map[string]func(io.Writer, lexer.TokenSource) error{
+		"json": lexer.WriteTokensJSON,
+		"csv":  lexer.WriteTokensCSV,
+	}[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	l := lexer.NewFromReader(f)
+	l.EmitComments(true)
+	if err := write(os.Stdout, l); err != nil {
+		return err
+	}
+	return l.Err()
+}
+
+// explain implements `monkey explain -e expr`, which shows how the parser
+// groups an expression.
+func explain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	expr := fs.String("e", "", "the expression to explain")
+	fs.Parse(args)
+
+	if *expr == "" || fs.NArg() != 0 {
+		return fmt.Errorf("usage: monkey explain -e expr")
+	}
+	return parser.Explain(os.Stdout, *expr)
+}
+
+// transpileProgram implements `monkey transpile path`, which writes a Go
+// command that runs the program at path as `monkey run` would to standard
+// output. The files of a directory are joined in name order.
+func transpileProgram(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: monkey transpile file.monkey|dir")
+	}
+	programs, err := loadPrograms(args[0])
+	if err != nil {
+		return err
+	}
+
+	program := &ast.Program{}
+	for _, p := range programs {
+		program.Statements = append(program.Statements, p.Statements...)
+	}
+	src, err := transpile.Program(program)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(src)
+	return err
+}
+
+// printGrammar writes the parser's operator table to w, one operator per
+// line from the loosest binding to the tightest.
+func printGrammar(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "OPERATOR\tKIND\tPRECEDENCE\tLEVEL\tASSOCIATIVITY")
+	for _, op := range parser.Operators() {
+		kind := "infix"
+		if op.Prefix {
+			kind = "prefix"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", op.Token, kind, op.Precedence, op.Level, op.Assoc)
+	}
+	tw.Flush()
 }
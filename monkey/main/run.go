@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"monkey/ast"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchInterval is how often `monkey run --watch` checks for changes.
+const watchInterval = 500 * time.Millisecond
+
+// run implements `monkey run [--watch] path [args...]`. path is a script
+// or a directory whose .monkey files are evaluated in name order as a
+// single program. If the program defines main, it is called with the
+// arguments, which must be integers, and an integer it returns becomes the
+// exit status. Any other result except null is printed.
+func run(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	watch := fs.Bool("watch", false, "run again whenever the program's files change")
+	fs.Parse(args)
+
+	args = fs.Args()
+	if len(args) == 0 {
+		return fmt.Errorf("usage: monkey run [--watch] path [args...]")
+	}
+	mainArgs := []object.Object{}
+	for _, arg := range args[1:] {
+		n, err := strconv.ParseInt(arg, 0, 64)
+		if err != nil {
+			return fmt.Errorf("argument %q is not an integer", arg)
+		}
+		mainArgs = append(mainArgs, &object.Integer{Value: n})
+	}
+
+	if *watch {
+		return watchProgram(args[0], mainArgs)
+	}
+
+	programs, err := loadPrograms(args[0])
+	if err != nil {
+		return err
+	}
+
+	env := object.NewEnvironment()
+	result := eval.Run(context.Background(), programs, env, mainArgs...)
+	if errObj, ok := result.(*object.Error); ok {
+		return errors.New(errObj.Message)
+	}
+	if _, hasMain := env.Get(eval.MAIN); hasMain {
+		if code, ok := result.(*object.Integer); ok {
+			os.Exit(int(code.Value))
+		}
+	}
+	if result != eval.NULL {
+		fmt.Println(result.Inspect())
+	}
+	return nil
+}
+
+// watchProgram runs the program at path whenever one of its files
+// changes, until the process is interrupted. The first result is printed
+// in full, later ones as their difference from the one before. Parse
+// errors count as results, so fixing them shows up as a change too.
+func watchProgram(path string, args []object.Object) error {
+	var last object.Object
+	stamp := ""
+	for ; ; time.Sleep(watchInterval) {
+		s, err := sourceStamp(path)
+		if err != nil {
+			return err
+		}
+		if s == stamp {
+			continue
+		}
+		stamp = s
+
+		var result object.Object
+		if programs, err := loadPrograms(path); err != nil {
+			result = &object.Error{Message: err.Error()}
+		} else {
+			result = eval.Run(context.Background(), programs, object.NewEnvironment(), args...)
+		}
+
+		fmt.Printf("--- %s %s\n", time.Now().Format(time.TimeOnly), path)
+		switch diff := object.Diff(last, result); {
+		case last == nil:
+			fmt.Println(result.Inspect())
+		case diff == "":
+			fmt.Println("(unchanged)")
+		default:
+			fmt.Println(diff)
+		}
+		last = result
+	}
+}
+
+// sourceStamp summarizes the names, sizes and modification times of the
+// program files at path, so that any change to them changes the stamp.
+func sourceStamp(path string) (string, error) {
+	files, err := programFiles(path)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", file, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// programFiles returns path if it is a file, or the .monkey files in it, in
+// name order, if it is a directory.
+func programFiles(path string) ([]string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return []string{path}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.monkey"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .monkey files in %s", path)
+	}
+	return files, nil
+}
+
+// loadPrograms parses the program files at path.
+func loadPrograms(path string) ([]*ast.Program, error) {
+	files, err := programFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	programs := []*ast.Program{}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		p := parser.New(lexer.NewBytes(src))
+		program := p.ParseProgram()
+		if errs := p.Errors(); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: %s", file, strings.Join(errs, "\n\t"))
+		}
+		programs = append(programs, program)
+	}
+	return programs, nil
+}
@@ -0,0 +1,265 @@
+// Package monkey is the supported API for embedding the Monkey interpreter
+// in Go programs. Its contract stays stable across releases, while the
+// packages it builds on, such as lexer, parser, eval and object, may
+// change as the interpreter evolves.
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimize"
+	"monkey/parser"
+	"strings"
+	"time"
+)
+
+// Version is the version of the API of this package.
+const Version = "1.0.0"
+
+// Value is a Monkey value. Its zero value is null. Use FromGo and ToGo to
+// convert between Monkey and Go values.
+type Value struct {
+	obj object.Object
+}
+
+// Null is Monkey's null.
+var Null = Value{}
+
+// String returns the value as Monkey would print it.
+func (v Value) String() string {
+	return v.object().Inspect()
+}
+
+// object returns the evaluator's representation of v.
+func (v Value) object() object.Object {
+	if v.obj == nil {
+		return eval.NULL
+	}
+	return v.obj
+}
+
+// objects converts values for the evaluator.
+func objects(values []Value) []object.Object {
+	objs := make([]object.Object, len(values))
+	for i, v := range values {
+		objs[i] = v.object()
+	}
+	return objs
+}
+
+// Options configure an Interpreter. The zero value is ready to use.
+type Options struct {
+	// Timeout, if positive, bounds each call to Eval or Call on its own.
+	Timeout time.Duration
+
+	// MaxDepth limits how deeply expressions may nest in source. Zero
+	// means parser.DefaultMaxDepth; negative disables the limit.
+	MaxDepth int
+
+	// Optimize runs the optimizer over programs before evaluating them.
+	Optimize bool
+}
+
+// Interpreter evaluates Monkey source in a global environment that
+// persists between calls, as a REPL session does. It is not safe for
+// concurrent use.
+type Interpreter struct {
+	opts Options
+	env  *object.Environment
+}
+
+// New creates an Interpreter with an empty environment.
+func New(opts Options) *Interpreter {
+	return &Interpreter{opts: opts, env: object.NewEnvironment()}
+}
+
+// SyntaxError is returned for source that does not parse.
+type SyntaxError struct {
+	Errors []string
+}
+
+func (e *SyntaxError) Error() string {
+	return "syntax error: " + strings.Join(e.Errors, "; ")
+}
+
+// RuntimeError is returned when evaluation fails, including when it is
+// cancelled or runs out of time.
+type RuntimeError struct {
+	Message string
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Message
+}
+
+// Eval parses and evaluates src and returns the value of its last
+// statement. Bindings it makes remain for later calls.
+func (in *Interpreter) Eval(ctx context.Context, src string) (Value, error) {
+	var opts []parser.Option
+	if in.opts.MaxDepth != 0 {
+		opts = append(opts, parser.WithMaxDepth(in.opts.MaxDepth))
+	}
+	p := parser.New(lexer.New(src), opts...)
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return Null, &SyntaxError{Errors: errs}
+	}
+	if in.opts.Optimize {
+		optimize.PropagateConstants(program)
+	}
+
+	ctx, cancel := in.context(ctx)
+	defer cancel()
+	return result(eval.EvalContext(ctx, program, in.env))
+}
+
+// Call calls the function bound to name with args.
+func (in *Interpreter) Call(ctx context.Context, name string, args ...Value) (Value, error) {
+	fn, ok := in.env.Get(name)
+	if !ok {
+		return Null, &RuntimeError{Message: "identifier not found: " + name}
+	}
+
+	ctx, cancel := in.context(ctx)
+	defer cancel()
+	return result(eval.Apply(ctx, fn, objects(args)))
+}
+
+// Set binds name to v in the global environment.
+func (in *Interpreter) Set(name string, v Value) {
+	in.env.Set(name, v.object())
+}
+
+// Get returns the value bound to name in the global environment.
+func (in *Interpreter) Get(name string) (Value, bool) {
+	obj, ok := in.env.Get(name)
+	return Value{obj}, ok
+}
+
+func (in *Interpreter) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if in.opts.Timeout > 0 {
+		return context.WithTimeout(ctx, in.opts.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// result turns the outcome of an evaluation into a value and an error.
+func result(obj object.Object) (Value, error) {
+	switch obj := obj.(type) {
+	case nil:
+		return Null, nil
+	case *object.Error:
+		return Null, &RuntimeError{Message: obj.Message}
+	case *object.ReturnValue:
+		return Value{obj.Value}, nil
+	}
+	return Value{obj}, nil
+}
+
+// Func returns a Monkey function implemented in Go. An error returned by
+// fn becomes a Monkey error, which stops the calling program.
+func Func(name string, fn func(ctx context.Context, args ...Value) (Value, error)) Value {
+	return Value{&object.Builtin{Name: name, Fn: func(ctx context.Context, args ...object.Object) object.Object {
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = Value{arg}
+		}
+		v, err := fn(ctx, values...)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return v.object()
+	}}}
+}
+
+// FromGo converts x to a Monkey value. It accepts nil, bools, integers of
+// any type whose value fits an int64, slices of values it accepts, which
+// become tuples, and Values, which are returned as they are.
+func FromGo(x interface{}) (Value, error) {
+	switch x := x.(type) {
+	case nil:
+		return Null, nil
+	case Value:
+		return x, nil
+	case bool:
+		return Value{eval.Bool(x)}, nil
+	case int:
+		return integer(int64(x)), nil
+	case int8:
+		return integer(int64(x)), nil
+	case int16:
+		return integer(int64(x)), nil
+	case int32:
+		return integer(int64(x)), nil
+	case int64:
+		return integer(x), nil
+	case uint:
+		return unsigned(uint64(x))
+	case uint8:
+		return integer(int64(x)), nil
+	case uint16:
+		return integer(int64(x)), nil
+	case uint32:
+		return integer(int64(x)), nil
+	case uint64:
+		return unsigned(x)
+	case []interface{}:
+		elements := make([]object.Object, len(x))
+		for i, el := range x {
+			v, err := FromGo(el)
+			if err != nil {
+				return Null, err
+			}
+			elements[i] = v.object()
+		}
+		return Value{&object.Tuple{Elements: elements}}, nil
+	}
+	return Null, fmt.Errorf("cannot convert %T to a Monkey value", x)
+}
+
+func integer(n int64) Value {
+	return Value{&object.Integer{Value: n}}
+}
+
+// unsigned converts n to a Monkey integer if it fits an int64.
+func unsigned(n uint64) (Value, error) {
+	if n > math.MaxInt64 {
+		return Null, fmt.Errorf("cannot convert %d to a Monkey value: out of range", n)
+	}
+	return integer(int64(n)), nil
+}
+
+// ToGo converts v to a Go value: nil for null, a bool, an int64, a
+// []interface{} for a tuple, or the Go value held by a host object.
+// Functions have no Go counterpart and are returned as they are.
+func ToGo(v Value) (interface{}, error) {
+	switch v := v.object().(type) {
+	case *object.Null:
+		return nil, nil
+	case *object.Boolean:
+		return v.Value, nil
+	case *object.Integer:
+		return v.Value, nil
+	case *object.Tuple:
+		elements := make([]interface{}, len(v.Elements))
+		for i, el := range v.Elements {
+			x, err := ToGo(Value{el})
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = x
+		}
+		return elements, nil
+	case *object.Host:
+		return v.Value, nil
+	case *object.Function, *object.Builtin:
+		return Value{v}, nil
+	case *object.Error:
+		return nil, &RuntimeError{Message: v.Message}
+	}
+	return nil, fmt.Errorf("cannot convert %s to a Go value", v.object().Type())
+}
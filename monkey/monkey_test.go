@@ -0,0 +1,104 @@
+package monkey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInterpreter(t *testing.T) {
+	ctx := context.Background()
+	in := New(Options{Optimize: true})
+
+	double := Func("double", func(ctx context.Context, args ...Value) (Value, error) {
+		x, err := ToGo(args[0])
+		if err != nil {
+			return Null, err
+		}
+		n, ok := x.(int64)
+		if !ok {
+			return Null, errors.New("double needs an integer")
+		}
+		return FromGo(2 * n)
+	})
+	in.Set("double", double)
+
+	if _, err := in.Eval(ctx, "let pair = fn(x) { return x, double(x); };"); err != nil {
+		t.Fatalf("Eval: %v", err)
+	}
+	v, err := in.Call(ctx, "pair", mustFromGo(t, 21))
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	x, err := ToGo(v)
+	if err != nil {
+		t.Fatalf("ToGo: %v", err)
+	}
+	if want := []interface{}{int64(21), int64(42)}; !reflect.DeepEqual(x, want) {
+		t.Errorf("expected %v. got=%v", want, x)
+	}
+
+	var runtimeErr *RuntimeError
+	if _, err := in.Eval(ctx, "double(true)"); !errors.As(err, &runtimeErr) || runtimeErr.Message != "double needs an integer" {
+		t.Errorf("expected the error of double. got=%v", err)
+	}
+	var syntaxErr *SyntaxError
+	if _, err := in.Eval(ctx, "let = 1;"); !errors.As(err, &syntaxErr) {
+		t.Errorf("expected a syntax error. got=%v", err)
+	}
+	if _, err := in.Call(ctx, "missing"); !errors.As(err, &runtimeErr) {
+		t.Errorf("expected a runtime error calling an unbound name. got=%v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	in := New(Options{Timeout: 10 * time.Millisecond})
+	_, err := in.Eval(context.Background(), "let loop = fn() { loop() }; loop()")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected a runtime error. got=%v", err)
+	}
+}
+
+func TestConversions(t *testing.T) {
+	for _, x := range []interface{}{nil, true, int64(-3), []interface{}{int64(1), []interface{}{false, nil}}} {
+		v := mustFromGo(t, x)
+		back, err := ToGo(v)
+		if err != nil {
+			t.Fatalf("ToGo(%s): %v", v, err)
+		}
+		if !reflect.DeepEqual(back, x) {
+			t.Errorf("expected %v to convert back. got=%v", x, back)
+		}
+	}
+
+	if _, err := FromGo(1.5); err == nil {
+		t.Errorf("expected an error converting a float")
+	}
+
+	for _, x := range []interface{}{uint(7), uint64(math.MaxInt64)} {
+		if v := mustFromGo(t, x); v.String() != fmt.Sprint(x) {
+			t.Errorf("expected %v to convert to an integer. got=%s", x, v)
+		}
+	}
+	if _, err := FromGo(uint64(math.MaxInt64 + 1)); err == nil {
+		t.Errorf("expected an error converting an unsigned integer that overflows int64")
+	}
+
+	if v := (Value{}); v.String() != "null" {
+		t.Errorf("expected the zero Value to be null. got=%s", v)
+	}
+}
+
+func mustFromGo(t *testing.T, x interface{}) Value {
+	t.Helper()
+	v, err := FromGo(x)
+	if err != nil {
+		t.Fatalf("FromGo(%v): %v", x, err)
+	}
+	return v
+}
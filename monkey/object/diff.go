@@ -0,0 +1,54 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Diff describes how b differs from a, one difference per line, or returns
+// "" if they are equal. Tuples are compared element by element and each
+// difference names the path to it, e.g. `[1][0]: 2 != 3`. Other values
+// compare by type and inspected value.
+func Diff(a, b Object) string {
+	var lines []string
+	diff(&lines, "", a, b)
+	return strings.Join(lines, "\n")
+}
+
+func diff(lines *[]string, path string, a, b Object) {
+	report := func(format string, args ...interface{}) {
+		line := fmt.Sprintf(format, args...)
+		if path != "" {
+			line = path + ": " + line
+		}
+		*lines = append(*lines, line)
+	}
+
+	switch {
+	case a == nil || b == nil:
+		if a != b {
+			report("%s != %s", describe(a), describe(b))
+		}
+	case a.Type() != b.Type():
+		report("%s != %s", describe(a), describe(b))
+	case a.Type() == TUPLE_OBJ:
+		at, bt := a.(*Tuple), b.(*Tuple)
+		if len(at.Elements) != len(bt.Elements) {
+			report("tuple of %d values != tuple of %d values", len(at.Elements), len(bt.Elements))
+			return
+		}
+		for i := range at.Elements {
+			diff(lines, fmt.Sprintf("%s[%d]", path, i), at.Elements[i], bt.Elements[i])
+		}
+	case a.Inspect() != b.Inspect():
+		report("%s != %s", a.Inspect(), b.Inspect())
+	}
+}
+
+// describe renders obj with its type, for differences in type.
+func describe(obj Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
+}
@@ -0,0 +1,32 @@
+package object
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	yes := &Boolean{Value: true}
+	tuple := func(elements ...Object) *Tuple { return &Tuple{Elements: elements} }
+
+	tests := []struct {
+		a, b     Object
+		expected string
+	}{
+		{one, &Integer{Value: 1}, ""},
+		{one, two, "1 != 2"},
+		{one, yes, "INTEGER 1 != BOOLEAN true"},
+		{one, nil, "INTEGER 1 != <nil>"},
+		{nil, nil, ""},
+		{&Error{Message: "a"}, &Error{Message: "b"}, "a != b"},
+		{tuple(one, tuple(two, yes)), tuple(one, tuple(two, yes)), ""},
+		{tuple(one, tuple(two, yes)), tuple(two, tuple(one, yes)), "[0]: 1 != 2\n[1][0]: 2 != 1"},
+		{tuple(one, tuple(two, yes)), tuple(one, tuple(two, one)), "[1][1]: BOOLEAN true != INTEGER 1"},
+		{tuple(one), tuple(one, two), "tuple of 1 values != tuple of 2 values"},
+		{tuple(tuple(one)), tuple(tuple()), "[0]: tuple of 1 values != tuple of 0 values"},
+	}
+
+	for _, tt := range tests {
+		if got := Diff(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Diff(%s, %s): expected %q. got=%q", describe(tt.a), describe(tt.b), tt.expected, got)
+		}
+	}
+}
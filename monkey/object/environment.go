@@ -1,5 +1,7 @@
 package object
 
+import "sync/atomic"
+
 func NewEnvironment() *Environment {
 	return &Environment{store: make(map[string]Object), outer: nil}
 }
@@ -8,9 +10,17 @@ func NewEnclosedEnvironment(out *Environment) *Environment {
 	return &Environment{store: make(map[string]Object), outer: out}
 }
 
+// NewCallEnvironment returns the environment of a call to a function
+// closed over out.
+func NewCallEnvironment(out *Environment) *Environment {
+	return &Environment{store: make(map[string]Object), outer: out, call: true}
+}
+
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	outer  *Environment
+	frozen bool
+	call   bool
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -23,7 +33,117 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// bindings counts the names bound outside calls; see Bindings.
+var bindings atomic.Uint64
+
+// Bindings returns a number that changes whenever a name is bound in an
+// environment that is not a call's. What GetUnbound finds in a given
+// environment stays the same for as long as this number does.
+func Bindings() uint64 {
+	return bindings.Load()
+}
+
+// Outside returns e, or if e is the environment of a call, the innermost
+// environment enclosing it that is not, or nil if there is none.
+// GetUnbound gives the same results for both.
+func (e *Environment) Outside() *Environment {
+	scope := e
+	for scope != nil && scope.call {
+		scope = scope.outer
+	}
+	return scope
+}
+
+// GetUnbound looks name up like Get but skips the environments of calls.
+// It is meant for names that no let or parameter of their program binds,
+// which calls therefore cannot bind either.
+func (e *Environment) GetUnbound(name string) (Object, bool) {
+	for scope := e; scope != nil; scope = scope.outer {
+		if scope.call {
+			continue
+		}
+		if obj, ok := scope.store[name]; ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
 func (e *Environment) Set(name string, obj Object) Object {
+	if e.frozen {
+		panic("cannot set " + name + " in a snapshot environment")
+	}
+	if !e.call {
+		bindings.Add(1)
+	}
 	e.store[name] = obj
 	return obj
 }
+
+// Trim returns an environment that resolves names just as e does but keeps
+// fewer scopes alive. Closures trim their environment to the names they
+// use so that they do not retain unrelated bindings of the functions they
+// were created in. A scope between e and the one binding a name may still
+// bind that name later and shadow it, so every scope up to the outermost
+// binding one is kept, and nothing is trimmed if a name is not bound yet.
+// Only the scopes beyond those, except the outermost scope, are dropped.
+func (e *Environment) Trim(names []string) *Environment {
+	chain := []*Environment{}
+	for scope := e; scope != nil; scope = scope.outer {
+		chain = append(chain, scope)
+	}
+
+	keep := 0
+	for _, name := range names {
+		i := bindingScope(chain, name)
+		if i < 0 {
+			return e
+		}
+		keep = max(keep, i)
+	}
+	if keep >= len(chain)-2 {
+		return e
+	}
+
+	// relink the kept scopes onto the outermost one, sharing their stores
+	// so later bindings in them stay visible
+	trimmed := chain[len(chain)-1]
+	for i := keep; i >= 0; i-- {
+		trimmed = &Environment{store: chain[i].store, outer: trimmed, frozen: chain[i].frozen, call: chain[i].call}
+	}
+	return trimmed
+}
+
+// bindingScope returns the index of the innermost scope of chain binding
+// name, or -1.
+func bindingScope(chain []*Environment, name string) int {
+	for i, scope := range chain {
+		if _, ok := scope.store[name]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// Snapshot is a read-only environment, typically holding the bindings of a
+// prelude that was evaluated once. Clones share those bindings instead of
+// copying them, so cloning is cheap however large the prelude is, and
+// clones of one snapshot may be used from several goroutines at once.
+type Snapshot struct {
+	env *Environment
+}
+
+// Snapshot freezes e and returns it as a Snapshot; setting a name in e
+// afterwards panics. The evaluator only ever sets names in the environment
+// it is given and in the ones it creates for calls, so evaluating in clones
+// leaves the snapshot untouched.
+func (e *Environment) Snapshot() *Snapshot {
+	e.frozen = true
+	return &Snapshot{env: e}
+}
+
+// Clone returns a fresh environment that sees every binding of s. Names
+// bound in the clone shadow, but do not change, those of the snapshot.
+func (s *Snapshot) Clone() *Environment {
+	return NewEnclosedEnvironment(s.env)
+}
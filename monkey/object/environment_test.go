@@ -0,0 +1,55 @@
+package object
+
+import "testing"
+
+func TestTrim(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("g", &Integer{Value: 1})
+	outer := NewEnclosedEnvironment(global)
+	outer.Set("big", &Integer{Value: 2})
+	middle := NewEnclosedEnvironment(outer)
+	middle.Set("x", &Integer{Value: 3})
+	inner := NewEnclosedEnvironment(middle)
+	inner.Set("y", &Integer{Value: 4})
+
+	trimmed := inner.Trim([]string{"x", "y"})
+
+	depth := 0
+	for scope := trimmed; scope != nil; scope = scope.outer {
+		depth++
+	}
+	if depth != 3 {
+		t.Errorf("expected inner, middle and global scopes. got depth=%d", depth)
+	}
+	for _, name := range []string{"g", "x", "y"} {
+		if _, ok := trimmed.Get(name); !ok {
+			t.Errorf("%s not found in trimmed environment", name)
+		}
+	}
+	if _, ok := trimmed.Get("big"); ok {
+		t.Errorf("trimmed environment still reaches big")
+	}
+
+	// kept scopes are shared, not copied
+	inner.Set("later", &Integer{Value: 5})
+	if _, ok := trimmed.Get("later"); !ok {
+		t.Errorf("binding made after trimming is not visible")
+	}
+	middle.Set("g", &Integer{Value: 6})
+	if g, _ := trimmed.Get("g"); g.Inspect() != "6" {
+		t.Errorf("binding shadowing the global one is not visible. g=%s", g.Inspect())
+	}
+
+	if got := global.Trim([]string{"g"}); got != global {
+		t.Errorf("trimming a single scope should return it unchanged")
+	}
+	if got := inner.Trim([]string{"x", "big"}); got != inner {
+		t.Errorf("trimming without skipping a scope should return it unchanged")
+	}
+	// any scope may bind these later
+	for _, names := range [][]string{{"x", "unbound"}, {"x", "len"}} {
+		if got := inner.Trim(names); got != inner {
+			t.Errorf("trimming to %v should return the environment unchanged", names)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package object
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// InfixHandler implements binary operators for a host type. It is called
+// whenever either operand has the type, and returns nil for operators or
+// operands it does not handle, leaving them to the evaluator's defaults.
+type InfixHandler func(operator string, left, right Object) Object
+
+// HostType describes an object type supplied by an embedding program, such
+// as a database handle that scripts pass between builtins.
+type HostType struct {
+	Name ObjectType
+
+	// Inspect renders the value of a Host object; if nil, the value is
+	// printed with fmt's %v.
+	Inspect func(value interface{}) string
+
+	// Infix, if set, is consulted by the evaluator before its own rules.
+	Infix InfixHandler
+}
+
+// hostTypes holds the registry. It is replaced, never modified, on
+// registration, so the evaluator can read it on every operator without
+// locking.
+var (
+	hostTypesMu sync.Mutex
+	hostTypes   atomic.Pointer[map[ObjectType]*HostType]
+)
+
+var builtinTypes = map[ObjectType]bool{
+	INTEGER_OBJ: true, BOOLEAN_OBJ: true, NULL_OBJ: true, RETURN_VALUE_OBJ: true,
+	ERROR_OBJ: true, FUNCTION_OBJ: true, BUILTIN_OBJ: true, TUPLE_OBJ: true,
+}
+
+// RegisterType registers a host type. Host values can then be created with
+// NewHost, or by any Object implementation whose Type returns t.Name.
+func RegisterType(t HostType) (*HostType, error) {
+	hostTypesMu.Lock()
+	defer hostTypesMu.Unlock()
+
+	if t.Name == "" {
+		return nil, fmt.Errorf("host type needs a name")
+	}
+	if _, ok := LookupType(t.Name); ok || builtinTypes[t.Name] {
+		return nil, fmt.Errorf("object type %s is already defined", t.Name)
+	}
+
+	registered := &t
+	types := map[ObjectType]*HostType{t.Name: registered}
+	if old := hostTypes.Load(); old != nil {
+		for name, typ := range *old {
+			types[name] = typ
+		}
+	}
+	hostTypes.Store(&types)
+	return registered, nil
+}
+
+// LookupType returns the registered host type called name.
+func LookupType(name ObjectType) (*HostType, bool) {
+	types := hostTypes.Load()
+	if types == nil {
+		return nil, false
+	}
+	t, ok := (*types)[name]
+	return t, ok
+}
+
+// Host wraps a Go value of a registered host type.
+type Host struct {
+	HostType *HostType
+	Value    interface{}
+}
+
+func NewHost(t *HostType, value interface{}) *Host {
+	return &Host{HostType: t, Value: value}
+}
+
+func (h *Host) Type() ObjectType { return h.HostType.Name }
+func (h *Host) Inspect() string {
+	if h.HostType.Inspect != nil {
+		return h.HostType.Inspect(h.Value)
+	}
+	return fmt.Sprintf("%v", h.Value)
+}
@@ -0,0 +1,73 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ellipsis stands in for whatever InspectLimits left out.
+const Ellipsis = "..."
+
+// InspectLimits bounds the size of an inspected value so that printing a
+// huge one does not flood the output. Zero fields impose no limit.
+type InspectLimits struct {
+	// MaxElements is the number of elements shown of each tuple.
+	MaxElements int
+
+	// MaxDepth is the number of nested tuples shown; deeper ones are
+	// printed as (...).
+	MaxDepth int
+
+	// MaxString is the length in bytes beyond which the inspection of any
+	// other value, such as a function, is cut short. The cut never splits
+	// a UTF-8 character.
+	MaxString int
+}
+
+// DefaultInspectLimits are the limits the REPL prints values with.
+var DefaultInspectLimits = InspectLimits{MaxElements: 100, MaxDepth: 8, MaxString: 1000}
+
+// Inspect is like obj.Inspect but keeps within l. Whatever is left out is
+// marked with Ellipsis, along with the number of elements omitted from
+// tuples.
+func (l InspectLimits) Inspect(obj Object) string {
+	var out strings.Builder
+	l.inspect(&out, obj, 0)
+	return out.String()
+}
+
+func (l InspectLimits) inspect(out *strings.Builder, obj Object, depth int) {
+	t, ok := obj.(*Tuple)
+	if !ok {
+		s := obj.Inspect()
+		if l.MaxString > 0 && len(s) > l.MaxString {
+			// cut before the character the limit falls in, if any
+			end := l.MaxString
+			for end > 0 && !utf8.RuneStart(s[end]) {
+				end--
+			}
+			s = s[:end] + Ellipsis
+		}
+		out.WriteString(s)
+		return
+	}
+
+	if l.MaxDepth > 0 && depth >= l.MaxDepth {
+		out.WriteString("(" + Ellipsis + ")")
+		return
+	}
+
+	out.WriteString("(")
+	for i, el := range t.Elements {
+		if i > 0 {
+			out.WriteString(", ")
+		}
+		if l.MaxElements > 0 && i >= l.MaxElements {
+			fmt.Fprintf(out, "%s %d more", Ellipsis, len(t.Elements)-i)
+			break
+		}
+		l.inspect(out, el, depth+1)
+	}
+	out.WriteString(")")
+}
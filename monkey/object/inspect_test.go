@@ -0,0 +1,45 @@
+package object
+
+import (
+	"monkey/ast"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestInspectLimits(t *testing.T) {
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	tuple := func(elements ...Object) *Tuple { return &Tuple{Elements: elements} }
+	long := &Error{Message: "something went terribly wrong"}
+	// "fn(größe) {...", where the ö takes the sixth and seventh bytes
+	size := &Function{
+		Parameters: []*ast.Identifier{{Value: "größe"}},
+		Body:       &ast.BlockStatement{},
+	}
+
+	tests := []struct {
+		limits   InspectLimits
+		obj      Object
+		expected string
+	}{
+		{InspectLimits{}, tuple(one, tuple(two, long)), "(1, (2, something went terribly wrong))"},
+		{InspectLimits{MaxElements: 2}, tuple(one, two, one, two), "(1, 2, ... 2 more)"},
+		{InspectLimits{MaxElements: 2}, tuple(one, two), "(1, 2)"},
+		{InspectLimits{MaxDepth: 1}, tuple(one, tuple(two)), "(1, (...))"},
+		{InspectLimits{MaxDepth: 2}, tuple(tuple(tuple(one))), "(((...)))"},
+		{InspectLimits{MaxString: 9}, tuple(long, one), "(something..., 1)"},
+		{InspectLimits{MaxString: 9}, long, "something..."},
+		{InspectLimits{MaxString: 9}, one, "1"},
+		{InspectLimits{MaxString: 6}, size, "fn(gr..."},
+		{InspectLimits{MaxString: 7}, size, "fn(grö..."},
+	}
+
+	for _, tt := range tests {
+		got := tt.limits.Inspect(tt.obj)
+		if got != tt.expected {
+			t.Errorf("%+v.Inspect(%s): expected %q. got=%q", tt.limits, tt.obj.Inspect(), tt.expected, got)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("%+v.Inspect(%s) is not valid UTF-8: %q", tt.limits, tt.obj.Inspect(), got)
+		}
+	}
+}
@@ -1,7 +1,10 @@
+// Package object defines the values Monkey programs compute with. Package
+// monkey exposes them as Value; the concrete types here may still change.
 package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"monkey/ast"
 	"strings"
@@ -16,6 +19,8 @@ const (
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR_OBJ"
 	FUNCTION_OBJ     = "FUNCTION_OBJ"
+	BUILTIN_OBJ      = "BUILTIN"
+	TUPLE_OBJ        = "TUPLE"
 )
 
 type Object interface {
@@ -23,12 +28,27 @@ type Object interface {
 	Inspect() string
 }
 
+// HashKey identifies a value for use as a map key. Equal values have equal
+// hash keys.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by objects that can serve as keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
 type Integer struct {
 	Value int64
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
 
 type Boolean struct {
 	Value bool
@@ -36,11 +56,19 @@ type Boolean struct {
 
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
 
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
+func (n *Null) HashKey() HashKey { return HashKey{Type: n.Type()} }
 
 type ReturnValue struct {
 	Value Object
@@ -79,3 +107,35 @@ func (f *Function) Inspect() string {
 
 	return out.String()
 }
+
+// Tuple holds the values of a multi-value return such as `return a, b;`.
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string {
+	elements := []string{}
+	for _, el := range t.Elements {
+		elements = append(elements, el.Inspect())
+	}
+
+	return "(" + strings.Join(elements, ", ") + ")"
+}
+
+// BuiltinFunction implements a builtin in Go. ctx is the context of the
+// evaluation making the call, for builtins that call back into Monkey code.
+type BuiltinFunction func(ctx context.Context, args ...Object) Object
+
+type Builtin struct {
+	Name string
+	Fn   BuiltinFunction
+
+	// Signature and Doc describe the builtin for help output, e.g.
+	// "partial(f, args...)" and a sentence on what it does.
+	Signature string
+	Doc       string
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
@@ -0,0 +1,226 @@
+// Package optimize rewrites parsed programs into equivalent ones that are
+// cheaper to run. Passes modify the tree in place.
+package optimize
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// PropagateConstants replaces uses of let-bound constants, such as x in
+// `let x = 5; x * 2`, with the constant itself. A binding qualifies if its
+// value is an integer or boolean literal, possibly negated, and its name
+// is bound only once in its scope and not by a parameter, so that every
+// later use sees the same value.
+//
+// Inside a function, uses that follow the let are replaced, including in
+// nested functions that do not bind the name themselves, and the let is
+// dropped once nothing in the function refers to it. At the top level of
+// a program only the program's own statements are rewritten and the let
+// is kept: the bindings there outlive the program, in a REPL session or
+// the environment of a host, and may be rebound after functions that
+// refer to them were created.
+func PropagateConstants(program *ast.Program) {
+	program.Statements = propagate(program.Statements, nil, true)
+}
+
+// propagate propagates the constants of the scope made up of stmts, the
+// body of a program or of a function with the given parameters, into
+// stmts and the functions they contain, and returns the statements that
+// remain.
+func propagate(stmts []ast.Statement, params []*ast.Identifier, topLevel bool) []ast.Statement {
+	counts := bindingCounts(stmts)
+	for _, p := range params {
+		counts[p.Value]++
+	}
+
+	var drop map[ast.Statement]bool
+	for i, stmt := range stmts {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil || let.Else != nil || counts[let.Name.Value] != 1 || !isConstant(let.Value) {
+			continue
+		}
+
+		s := &substitution{name: let.Name.Value, value: let.Value, nested: !topLevel}
+		for _, later := range stmts[i+1:] {
+			s.statement(later)
+		}
+
+		// Removing the last statement would change the scope's result.
+		if !topLevel && i < len(stmts)-1 && !refersTo(stmts, let.Name.Value, let) {
+			if drop == nil {
+				drop = map[ast.Statement]bool{}
+			}
+			drop[let] = true
+		}
+	}
+
+	kept := stmts[:0]
+	for _, stmt := range stmts {
+		if !drop[stmt] {
+			kept = append(kept, stmt)
+		}
+	}
+
+	for _, stmt := range kept {
+		ast.Walk(stmt, func(n ast.Node) bool {
+			fl, ok := n.(*ast.FunctionLiteral)
+			if !ok {
+				return true
+			}
+			fl.Body.Statements = propagate(fl.Body.Statements, fl.Parameters, false)
+			if fl.Captures != nil {
+				fl.Captures = ast.FreeVariables(fl)
+			}
+			return false
+		})
+	}
+	return kept
+}
+
+// bindingCounts counts how often each name is bound by a let in the scope
+// made up of stmts. Blocks share their enclosing scope; functions do not.
+func bindingCounts(stmts []ast.Statement) map[string]int {
+	counts := map[string]int{}
+	for _, stmt := range stmts {
+		ast.Walk(stmt, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.LetStatement:
+				if n.Name != nil {
+					counts[n.Name.Value]++
+				}
+				for _, name := range n.Names {
+					counts[name.Value]++
+				}
+			}
+			return true
+		})
+	}
+	return counts
+}
+
+// refersTo reports whether stmts, other than the let binding name, still
+// mention name anywhere, including in nested functions.
+func refersTo(stmts []ast.Statement, name string, let *ast.LetStatement) bool {
+	found := false
+	for _, stmt := range stmts {
+		if stmt == ast.Statement(let) {
+			continue
+		}
+		ast.Walk(stmt, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Identifier); ok && ident.Value == name {
+				found = true
+			}
+			return !found
+		})
+	}
+	return found
+}
+
+// isConstant reports whether e is a literal that PropagateConstants may
+// copy to the places it is used.
+func isConstant(e ast.Expression) bool {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean:
+		return true
+	case *ast.PrefixExpression:
+		_, ok := e.Right.(*ast.IntegerLiteral)
+		return ok && e.Operator == "-"
+	}
+	return false
+}
+
+// substitution replaces the identifier name with value wherever it is
+// looked up. Unless nested is set, it leaves functions alone.
+type substitution struct {
+	name   string
+	value  ast.Expression
+	nested bool
+}
+
+func (s *substitution) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		stmt.Value = s.expression(stmt.Value)
+		s.block(stmt.Else)
+	case *ast.ReturnStatement:
+		stmt.ReturnValue = s.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		stmt.Expression = s.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		s.block(stmt)
+	}
+}
+
+func (s *substitution) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	for _, stmt := range b.Statements {
+		s.statement(stmt)
+	}
+}
+
+func (s *substitution) expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if e != nil && e.Value == s.name {
+			return copyAt(s.value, e.Token)
+		}
+	case *ast.PrefixExpression:
+		e.Right = s.expression(e.Right)
+	case *ast.InfixExpression:
+		e.Left = s.expression(e.Left)
+		e.Right = s.expression(e.Right)
+	case *ast.IfExpression:
+		e.Condition = s.expression(e.Condition)
+		s.block(e.Consequence)
+		s.block(e.Alternative)
+	case *ast.FunctionLiteral:
+		if s.nested && !shadows(e, s.name) {
+			s.block(e.Body)
+		}
+	case *ast.CallExpression:
+		e.Function = s.expression(e.Function)
+		for i, arg := range e.Arguments {
+			e.Arguments[i] = s.expression(arg)
+		}
+	case *ast.TupleLiteral:
+		for i, el := range e.Elements {
+			e.Elements[i] = s.expression(el)
+		}
+	}
+	return e
+}
+
+// shadows reports whether fl binds name itself, as a parameter or with a
+// let in its body.
+func shadows(fl *ast.FunctionLiteral, name string) bool {
+	for _, p := range fl.Parameters {
+		if p.Value == name {
+			return true
+		}
+	}
+	return bindingCounts(fl.Body.Statements)[name] > 0
+}
+
+// copyAt returns a copy of the constant value positioned at tok, the
+// token of the identifier it replaces, so that errors point at the use.
+func copyAt(value ast.Expression, tok token.Token) ast.Expression {
+	at := func(t token.Token) token.Token {
+		t.Offset, t.Line, t.Column = tok.Offset, tok.Line, tok.Column
+		return t
+	}
+
+	switch v := value.(type) {
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{Token: at(v.Token), Value: v.Value}
+	case *ast.Boolean:
+		return &ast.Boolean{Token: at(v.Token), Value: v.Value}
+	case *ast.PrefixExpression:
+		return &ast.PrefixExpression{Token: at(v.Token), Operator: v.Operator, Right: copyAt(v.Right, tok)}
+	}
+	return value
+}
@@ -0,0 +1,79 @@
+package optimize
+
+import (
+	"monkey/ast"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+func TestPropagateConstants(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5; x * 2", "let x = 5;\n5 * 2;"},
+		{"let x = -5; let y = true; if (y) { x }", "let x = -5;\nlet y = true;\nif (true) {\n  -5;\n};"},
+		// Functions at the top level may outlive the binding.
+		{"let x = 5; let f = fn() { x };", "let x = 5;\nlet f = fn() {\n  x;\n};"},
+		// Inside a function the binding is dropped once unused.
+		{"fn() { let x = 5; x + x }", "fn() {\n  5 + 5;\n};"},
+		{"fn() { let x = 5; fn(y) { x + y } }", "fn() {\n  fn(y) {\n    5 + y;\n  };\n};"},
+		// The last statement is the function's result.
+		{"fn() { let x = 5; }", "fn() {\n  let x = 5;\n};"},
+		// Shadowed by a parameter or a let of a nested function, whose
+		// mentions of the name keep the let.
+		{"fn() { let x = 5; fn(x) { x } }", "fn() {\n  let x = 5;\n  fn(x) {\n    x;\n  };\n};"},
+		{"fn() { let x = 5; fn() { let x = 6; x }; x }", "fn() {\n  let x = 5;\n  fn() {\n    6;\n  };\n  5;\n};"},
+		// Rebound in the same scope, also conditionally or by a parameter.
+		{"fn() { let x = 5; let x = 6; x }", "fn() {\n  let x = 5;\n  let x = 6;\n  x;\n};"},
+		{"fn(c) { let x = 5; if (c) { let x = 6; }; x }", "fn(c) {\n  let x = 5;\n  if (c) {\n    let x = 6;\n  };\n  x;\n};"},
+		{"fn(x) { let x = 5; x }", "fn(x) {\n  let x = 5;\n  x;\n};"},
+		// Uses before the let see another binding.
+		{"fn() { let y = x; let x = 5; x + y }", "fn() {\n  let y = x;\n  let x = 5;\n  5 + y;\n};"},
+		// Only literals qualify.
+		{"fn() { let x = 1 + 2; x }", "fn() {\n  let x = 1 + 2;\n  x;\n};"},
+		{"fn() { let x = !true; x }", "fn() {\n  let x = !true;\n  x;\n};"},
+		{"fn() { let x = 5 else { return 0; }; x }", "fn() {\n  let x = 5 else {\n    return 0;\n  };\n  x;\n};"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		PropagateConstants(program)
+		if got := strings.TrimSpace(ast.Format(program)); got != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPropagateConstantsPreservesResults(t *testing.T) {
+	tests := []string{
+		"let x = 5; let f = fn() { x }; let x = 6; f()",
+		"let f = fn(n) { let step = 2; let g = fn(m) { m * step }; g(n) + step }; f(10)",
+		"let f = fn(c) { let x = 5; if (c) { x } else { -x } }; f(true) + f(false)",
+		"let f = fn() { let (a, b) = fn() { return 1, 2; }(); let c = 3; a + b + c }; f()",
+		"let f = fn() { let x = 5; x + y }; f()",
+	}
+
+	for _, input := range tests {
+		want := eval.Eval(parse(t, input), object.NewEnvironment())
+		program := parse(t, input)
+		PropagateConstants(program)
+		got := eval.Eval(program, object.NewEnvironment())
+		if d := object.Diff(want, got); d != "" {
+			t.Errorf("%s: result changed: %s", input, d)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("%s: parser errors: %v", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/lexer"
+	"strconv"
+	"strings"
+)
+
+// Explain parses src, which must be a single expression, and writes to w
+// how the parser understood it, for teaching how precedence works: the
+// expression with every operation in parentheses, the tree of operators
+// with the precedence each one binds with, and the tree of parse function
+// calls that built it.
+func Explain(w io.Writer, src string) error {
+	root := &traceNode{}
+	p := New(lexer.New(src), WithTrace(io.Discard))
+	p.traceStack = []*traceNode{root}
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+
+	var stmt *ast.ExpressionStatement
+	if len(program.Statements) == 1 {
+		stmt, _ = program.Statements[0].(*ast.ExpressionStatement)
+	}
+	if stmt == nil {
+		return fmt.Errorf("explain needs a single expression")
+	}
+
+	fmt.Fprintf(w, "parenthesized:\n    %s\n\nprecedence:\n", stmt.Expression.String())
+	writeTree(w, "    ", []explainNode{operatorTree(stmt.Expression)})
+	fmt.Fprintf(w, "\nparse functions:\n")
+	writeTree(w, "    ", traceTree(root.children))
+	return nil
+}
+
+// explainNode is a node of a tree printed by Explain.
+type explainNode struct {
+	label    string
+	children []explainNode
+}
+
+// operatorTree returns the tree of the operators in e. Operands that are
+// not operations appear as they are written.
+func operatorTree(e ast.Expression) explainNode {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		prec := Precedence(e.Token.Type)
+		return explainNode{
+			label:    fmt.Sprintf("%s    %s (%d)", e.Operator, levelNames[prec], prec),
+			children: []explainNode{operatorTree(e.Left), operatorTree(e.Right)},
+		}
+	case *ast.PrefixExpression:
+		return explainNode{
+			label:    fmt.Sprintf("%s (prefix)    %s (%d)", e.Operator, levelNames[PREFIX], PREFIX),
+			children: []explainNode{operatorTree(e.Right)},
+		}
+	case *ast.CallExpression:
+		n := explainNode{
+			label:    fmt.Sprintf("call    %s (%d)", levelNames[CALL], CALL),
+			children: []explainNode{operatorTree(e.Function)},
+		}
+		for _, arg := range e.Arguments {
+			n.children = append(n.children, operatorTree(arg))
+		}
+		return n
+	}
+	return explainNode{label: e.String()}
+}
+
+// traceTree converts recorded parse function calls, naming the precedence
+// levels that parseExpression is called with.
+func traceTree(calls []*traceNode) []explainNode {
+	nodes := make([]explainNode, len(calls))
+	for i, call := range calls {
+		label := call.name
+		if arg, ok := strings.CutPrefix(label, "parseExpression: "); ok {
+			if prec, err := strconv.Atoi(arg); err == nil {
+				label = "parseExpression(" + levelNames[prec] + ")"
+			}
+		}
+		nodes[i] = explainNode{label: label, children: traceTree(call.children)}
+	}
+	return nodes
+}
+
+// writeTree writes nodes and their descendants one per line, each line
+// starting with indent and with the branches leading to the node.
+func writeTree(w io.Writer, indent string, nodes []explainNode) {
+	for i, n := range nodes {
+		branch, next := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, branch, n.label)
+		writeTree(w, indent+next, n.children)
+	}
+}
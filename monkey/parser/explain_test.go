@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	var out strings.Builder
+	if err := Explain(&out, "1 + 2 * -x"); err != nil {
+		t.Fatalf("Explain: %v", err)
+	}
+
+	expected := `parenthesized:
+    (1 + (2 * (-x)))
+
+precedence:
+    └── +    SUM (4)
+        ├── 1
+        └── *    PRODUCT (5)
+            ├── 2
+            └── - (prefix)    PREFIX (6)
+                └── x
+
+parse functions:
+    └── parseExpressionStatement
+        └── parseExpression(LOWEST)
+            ├── parseIntegerLiteral
+            └── +:parseInfixExpression
+                └── parseExpression(SUM)
+                    ├── parseIntegerLiteral
+                    └── *:parseInfixExpression
+                        └── parseExpression(PRODUCT)
+                            └── parsePrefixExpression
+                                └── parseExpression(PREFIX)
+                                    └── parseIdentifier
+`
+	if got := out.String(); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	for _, input := range []string{"let x = 1;", "1; 2", "1 +"} {
+		if err := Explain(&out, input); err == nil {
+			t.Errorf("%q: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// Diagnostic is an error found while reading or parsing a file.
+type Diagnostic struct {
+	Path    string
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return d.Path + ": " + d.Message
+}
+
+type fileResult struct {
+	program     *ast.Program
+	diagnostics []Diagnostic
+}
+
+// ParseFiles reads and parses each of paths on a pool of worker goroutines.
+// It returns the parsed programs keyed by path and the diagnostics of all
+// files, ordered as the paths were given. Files that could not be read have
+// no program but are reported in the diagnostics.
+func ParseFiles(paths []string) (map[string]*ast.Program, []Diagnostic) {
+	results := make([]fileResult, len(paths))
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = parseFile(paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	programs := make(map[string]*ast.Program, len(paths))
+	diagnostics := []Diagnostic{}
+	for i, res := range results {
+		if res.program != nil {
+			programs[paths[i]] = res.program
+		}
+		diagnostics = append(diagnostics, res.diagnostics...)
+	}
+
+	return programs, diagnostics
+}
+
+func parseFile(path string) fileResult {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return fileResult{diagnostics: []Diagnostic{{Path: path, Message: err.Error()}}}
+	}
+
+	p := New(lexer.NewBytes(src))
+	res := fileResult{program: p.ParseProgram()}
+	for _, msg := range p.Errors() {
+		res.diagnostics = append(res.diagnostics, Diagnostic{Path: path, Message: msg})
+	}
+
+	return res
+}
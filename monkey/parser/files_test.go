@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.monkey":   "let a = 1;",
+		"b.monkey":   "let b = fn(x) { x * 2 }; b(a);",
+		"bad.monkey": "let x 5;",
+	}
+	paths := []string{}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	missing := filepath.Join(dir, "missing.monkey")
+	paths = append(paths, missing)
+
+	programs, diagnostics := ParseFiles(paths)
+
+	if len(programs) != 3 {
+		t.Fatalf("expected 3 programs. got=%d", len(programs))
+	}
+	if got := programs[filepath.Join(dir, "a.monkey")].String(); got != "let a = 1;" {
+		t.Errorf("a.monkey parsed wrong. got=%q", got)
+	}
+	if got := programs[filepath.Join(dir, "b.monkey")].String(); got != "let b = fn(x)(x * 2);b(a)" {
+		t.Errorf("b.monkey parsed wrong. got=%q", got)
+	}
+
+	if len(diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics. got=%d (%v)", len(diagnostics), diagnostics)
+	}
+	for _, d := range diagnostics {
+		switch d.Path {
+		case filepath.Join(dir, "bad.monkey"):
+			if !strings.Contains(d.Message, "=") {
+				t.Errorf("unexpected diagnostic for bad.monkey: %q", d.Message)
+			}
+		case missing:
+		default:
+			t.Errorf("unexpected diagnostic path %q", d.Path)
+		}
+	}
+}
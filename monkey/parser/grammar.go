@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"monkey/token"
+	"sort"
+)
+
+// prefixOperators are the tokens parsed as prefix operators, binding at
+// PREFIX precedence.
+var prefixOperators = []token.TokenType{token.BANG, token.MINUS}
+
+// levelNames names the precedence levels for Operators.
+var levelNames = map[int]string{
+	LOWEST:      "LOWEST",
+	EQUALS:      "EQUALS",
+	LESSGREATER: "LESSGREATER",
+	SUM:         "SUM",
+	PRODUCT:     "PRODUCT",
+	PREFIX:      "PREFIX",
+	CALL:        "CALL",
+}
+
+// Associativity says how a chain of operators of equal precedence groups.
+type Associativity int
+
+const (
+	LeftAssoc  Associativity = iota // a - b - c is (a - b) - c
+	RightAssoc                      // - - a is -(-a)
+)
+
+func (a Associativity) String() string {
+	if a == RightAssoc {
+		return "right"
+	}
+	return "left"
+}
+
+// Operator describes how the parser treats an operator token, for tools
+// and documentation that must agree with it. A call counts as the infix
+// operator `(`.
+type Operator struct {
+	Token      token.TokenType
+	Prefix     bool
+	Precedence int
+	Level      string // name of the precedence level, e.g. "SUM"
+	Assoc      Associativity
+}
+
+// Operators returns the operators the parser knows, from the loosest
+// binding to the tightest, prefix operators before infix ones of the same
+// precedence and otherwise in token order.
+func Operators() []Operator {
+	ops := []Operator{}
+	for _, tok := range prefixOperators {
+		ops = append(ops, Operator{Token: tok, Prefix: true, Precedence: PREFIX, Level: levelNames[PREFIX], Assoc: RightAssoc})
+	}
+	for tok, prec := range precedences {
+		ops = append(ops, Operator{Token: tok, Precedence: prec, Level: levelNames[prec], Assoc: LeftAssoc})
+	}
+
+	sort.Slice(ops, func(i, j int) bool {
+		a, b := ops[i], ops[j]
+		if a.Precedence != b.Precedence {
+			return a.Precedence < b.Precedence
+		}
+		if a.Prefix != b.Prefix {
+			return a.Prefix
+		}
+		return a.Token < b.Token
+	})
+	return ops
+}
+
+// Precedence returns the precedence with which tok binds as an infix
+// operator, or LOWEST if it is not one.
+func Precedence(tok token.TokenType) int {
+	if p, ok := precedences[tok]; ok {
+		return p
+	}
+	return LOWEST
+}
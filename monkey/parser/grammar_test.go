@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	ops := Operators()
+	if len(ops) != len(precedences)+len(prefixOperators) {
+		t.Fatalf("expected %d operators. got=%d", len(precedences)+len(prefixOperators), len(ops))
+	}
+	for i := 1; i < len(ops); i++ {
+		if ops[i].Precedence < ops[i-1].Precedence {
+			t.Errorf("operators out of order: %+v before %+v", ops[i-1], ops[i])
+		}
+	}
+
+	// The table must describe how the parser actually groups operators.
+	for _, op := range ops {
+		if op.Prefix || op.Token == token.LPAREN {
+			continue
+		}
+		input := "a " + string(op.Token) + " b " + string(op.Token) + " c"
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		expr := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+		_, leftNested := expr.Left.(*ast.InfixExpression)
+		if leftNested != (op.Assoc == LeftAssoc) {
+			t.Errorf("%s: grouped as %s, table says %s-associative", op.Token, expr, op.Assoc)
+		}
+	}
+
+	if got := Precedence(token.ASTERISK); got != PRODUCT {
+		t.Errorf("Precedence(*): expected %d. got=%d", PRODUCT, got)
+	}
+	if got := Precedence(token.BANG); got != LOWEST {
+		t.Errorf("Precedence(!): expected %d. got=%d", LOWEST, got)
+	}
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+)
+
+// Document is a parsed source file that is kept up to date as it is edited.
+// Update reparses only the top-level statements an edit touches and splices
+// them into the existing Program, which lets editors reparse on every
+// keystroke. Statements outside the edit are reused as-is, with their token
+// offsets shifted to match the new source.
+type Document struct {
+	src     string
+	program *ast.Program
+	errors  []string
+
+	// terminated records, per top-level statement, whether it ended in a
+	// semicolon. Only then can the following statement be reparsed without
+	// it, since otherwise an edit may join the two into one expression.
+	terminated []bool
+
+	// names interns identifiers across reparses, so reused and reparsed
+	// statements share name strings.
+	names *lexer.Names
+}
+
+func NewDocument(src string) *Document {
+	d := &Document{names: lexer.NewNames()}
+	d.parseAll(src)
+	return d
+}
+
+func (d *Document) Source() string        { return d.src }
+func (d *Document) Program() *ast.Program { return d.program }
+func (d *Document) Errors() []string      { return d.errors }
+
+// Update brings the document in line with newSrc, which is the current
+// source with the bytes in [start, end) replaced. If the current source has
+// parse errors, or the reparsed statements do, the whole file is parsed
+// again so that errors are always reported exactly as ParseProgram would.
+func (d *Document) Update(newSrc string, start, end int) {
+	delta := len(newSrc) - len(d.src)
+	if len(d.errors) > 0 || !d.isEdit(newSrc, start, end) {
+		d.parseAll(newSrc)
+		return
+	}
+
+	stmts := d.program.Statements
+	first, last := d.affected(start, end)
+
+	for {
+		if first > 0 && !d.terminated[first-1] {
+			first--
+			continue
+		}
+
+		regionStart := d.stmtStart(first)
+		regionEnd := d.stmtEnd(last) + delta
+		region, terminated, errors := parseRegion(newSrc, regionStart, regionEnd, d.names)
+		if len(errors) > 0 {
+			d.parseAll(newSrc)
+			return
+		}
+
+		endsClean := len(terminated) == 0 || terminated[len(terminated)-1]
+		if !endsClean && last < len(stmts)-1 {
+			last++
+			continue
+		}
+
+		from := position(d.src, d.stmtEnd(last))
+		to := position(newSrc, regionEnd)
+		for _, stmt := range stmts[last+1:] {
+			move(stmt, from, to)
+		}
+
+		newStmts := make([]ast.Statement, 0, first+len(region)+len(stmts)-last-1)
+		newStmts = append(newStmts, stmts[:first]...)
+		newStmts = append(newStmts, region...)
+		newStmts = append(newStmts, stmts[last+1:]...)
+
+		newTerminated := make([]bool, 0, len(newStmts))
+		newTerminated = append(newTerminated, d.terminated[:first]...)
+		newTerminated = append(newTerminated, terminated...)
+		newTerminated = append(newTerminated, d.terminated[last+1:]...)
+
+		d.src = newSrc
+		d.program = &ast.Program{Statements: newStmts}
+		d.terminated = newTerminated
+		return
+	}
+}
+
+// isEdit reports whether newSrc can be the result of replacing [start, end)
+// of the current source, i.e. both agree outside of the edited range.
+func (d *Document) isEdit(newSrc string, start, end int) bool {
+	if start < 0 || start > end || end > len(d.src) {
+		return false
+	}
+	tail := len(d.src) - end
+	if start+tail > len(newSrc) {
+		return false
+	}
+	return d.src[:start] == newSrc[:start] && d.src[end:] == newSrc[len(newSrc)-tail:]
+}
+
+// affected returns the indexes of the first and last top-level statements
+// whose source range overlaps or touches [start, end); a statement starting
+// right at end is included because inserted text may run into its first
+// token. If there are no statements, it returns (0, -1).
+func (d *Document) affected(start, end int) (int, int) {
+	stmts := d.program.Statements
+	if len(stmts) == 0 {
+		return 0, -1
+	}
+
+	first := 0
+	for first < len(stmts)-1 && d.stmtStart(first+1) <= start {
+		first++
+	}
+	last := first
+	for last < len(stmts)-1 && d.stmtStart(last+1) <= end {
+		last++
+	}
+
+	return first, last
+}
+
+// stmtStart returns the offset at which the source of the i-th statement
+// begins. Leading whitespace belongs to the first statement.
+func (d *Document) stmtStart(i int) int {
+	if i <= 0 {
+		return 0
+	}
+	return ast.TokenOf(d.program.Statements[i]).Offset
+}
+
+// stmtEnd returns the offset just past the source of the i-th statement,
+// which extends up to the start of the next one.
+func (d *Document) stmtEnd(i int) int {
+	if i >= len(d.program.Statements)-1 {
+		return len(d.src)
+	}
+	return d.stmtStart(i + 1)
+}
+
+func (d *Document) parseAll(src string) {
+	stmts, terminated, errors := parseRegion(src, 0, len(src), d.names)
+	d.src = src
+	d.program = &ast.Program{Statements: stmts}
+	d.terminated = terminated
+	d.errors = errors
+}
+
+// parseRegion parses src[start:end] as a sequence of top-level statements,
+// with token positions relative to the whole of src and identifiers interned
+// in names.
+func parseRegion(src string, start, end int, names *lexer.Names) (stmts []ast.Statement, terminated []bool, errors []string) {
+	l := lexer.New(src[start:end])
+	l.UseNames(names)
+	p := New(l)
+	from, to := pos{offset: 0, line: 1, column: 1}, position(src, start)
+
+	stmts, terminated = []ast.Statement{}, []bool{}
+
+	defer func() { errors = p.Errors() }()
+	defer p.recoverAbort()
+
+	for !p.curTokenIs(token.EOF) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			move(stmt, from, to)
+			stmts = append(stmts, stmt)
+			terminated = append(terminated, p.curTokenIs(token.SEMICOLON))
+		}
+		p.nextToken()
+	}
+
+	return stmts, terminated, nil
+}
+
+// pos is a source position in the same terms as token.Token's fields.
+type pos struct {
+	offset, line, column int
+}
+
+func position(src string, offset int) pos {
+	line := strings.Count(src[:offset], "\n") + 1
+	lineStart := strings.LastIndexByte(src[:offset], '\n') + 1
+	return pos{offset: offset, line: line, column: offset - lineStart + 1}
+}
+
+// move updates the positions of all tokens in node, which must lie at or
+// after from, as if the source at from had been moved to to. Columns only
+// change for tokens on the same line as from.
+func move(node ast.Node, from, to pos) {
+	if from == to {
+		return
+	}
+	ast.Walk(node, func(n ast.Node) bool {
+		if tok := ast.TokenOf(n); tok != nil {
+			tok.Offset += to.offset - from.offset
+			if tok.Line == from.line {
+				tok.Column += to.column - from.column
+			}
+			tok.Line += to.line - from.line
+		}
+		return true
+	})
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"testing"
+)
+
+func TestDocumentUpdate(t *testing.T) {
+	src := `let a = 1;
+let add = fn(x, y) { x + y; };
+add(a, 2);
+if (a < 2) { a } else { 3 }
+let b = a * 2;
+b`
+
+	tests := []struct {
+		name       string
+		src        string
+		start, end int
+		text       string
+	}{
+		{"replace literal", src, 8, 9, "42"},
+		{"edit function body", src, 32, 37, "x * y"},
+		{"insert statement", src, 81, 81, "let c = 3;\n"},
+		{"delete statement", src, 81, 96, ""},
+		{"break if expression", src, 56, 57, ""},
+		{"edit last statement", src, 96, 96, "c"},
+		{"append at end", src, len(src), len(src), " + 1;"},
+		{"insert at start", src, 0, 0, "5;"},
+		{"introduce error", src, 4, 5, ""},
+		{"replace everything", src, 0, len(src), "let z = 0;"},
+		{"join with next statement", "a;\n-b;\nc;", 1, 2, ""},
+		{"join with previous statement", "a\n;-b;", 2, 3, ""},
+		{"run into next token", "a;  b;", 2, 4, "c"},
+		{"shift statement on same line", "a; b;\nc;", 0, 1, "abc"},
+		{"split line", "a; b;\nc;", 2, 2, "\n\n"},
+		{"edit empty document", "", 0, 0, "let x = 1;"},
+	}
+
+	for _, tt := range tests {
+		d := NewDocument(tt.src)
+		newSrc := tt.src[:tt.start] + tt.text + tt.src[tt.end:]
+		d.Update(newSrc, tt.start, tt.end)
+
+		p := New(lexer.New(newSrc))
+		want := p.ParseProgram()
+
+		if d.Source() != newSrc {
+			t.Errorf("%s: source not updated", tt.name)
+		}
+		if len(d.Errors()) != len(p.Errors()) {
+			t.Errorf("%s: errors differ. want=%v, got=%v", tt.name, p.Errors(), d.Errors())
+			continue
+		}
+		if len(p.Errors()) > 0 {
+			continue
+		}
+		if got := d.Program().String(); got != want.String() {
+			t.Errorf("%s: program differs. want=%q, got=%q", tt.name, want.String(), got)
+		}
+		if got, want := tokenPositions(d.Program()), tokenPositions(want); !equalInts(got, want) {
+			t.Errorf("%s: token positions differ. want=%v, got=%v", tt.name, want, got)
+		}
+	}
+}
+
+func TestDocumentUpdateReusesStatements(t *testing.T) {
+	src := "let a = 1; let b = 2; let c = 3;"
+	d := NewDocument(src)
+	before := d.Program().Statements
+
+	d.Update("let a = 1; let b = 20; let c = 3;", 19, 20)
+	after := d.Program().Statements
+
+	if len(after) != 3 {
+		t.Fatalf("expected 3 statements. got=%d", len(after))
+	}
+	if after[0] != before[0] || after[2] != before[2] {
+		t.Errorf("statements outside the edit were reparsed")
+	}
+	if after[1] == before[1] {
+		t.Errorf("edited statement was not reparsed")
+	}
+	if got := after[1].String(); got != "let b = 20;" {
+		t.Errorf("edited statement wrong. got=%q", got)
+	}
+	if tok := ast.TokenOf(after[2]); tok.Offset != 23 || tok.Column != 24 {
+		t.Errorf("following statement not shifted. offset=%d, column=%d", tok.Offset, tok.Column)
+	}
+}
+
+func tokenPositions(node ast.Node) []int {
+	positions := []int{}
+	ast.Walk(node, func(n ast.Node) bool {
+		if tok := ast.TokenOf(n); tok != nil {
+			positions = append(positions, tok.Offset, tok.Line, tok.Column)
+		}
+		return true
+	})
+	return positions
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"io"
+	"monkey/ast"
+)
+
+// Option configures a Parser created by New.
+type Option func(*Parser)
+
+// WithTrace writes a trace of the parse functions as they are entered and
+// left to w.
+func WithTrace(w io.Writer) Option {
+	return func(p *Parser) {
+		p.DEBUG = true
+		p.traceOut = w
+	}
+}
+
+// WithMaxErrors stops parsing after n errors, adding a final "too many
+// errors" message. n <= 0 means no limit, which is the default.
+func WithMaxErrors(n int) Option {
+	return func(p *Parser) {
+		p.maxErrors = n
+	}
+}
+
+// WithMaxDepth limits how deeply expressions may nest; see
+// DefaultMaxDepth. n <= 0 disables the limit.
+func WithMaxDepth(n int) Option {
+	return func(p *Parser) {
+		p.maxDepth = n
+	}
+}
+
+// WithArena allocates the parser's AST nodes from a; see UseArena.
+func WithArena(a *ast.Arena) Option {
+	return func(p *Parser) {
+		p.arena = a
+	}
+}
+
+// WithNewlineSemicolons ends statements at line ends, as Go does. It makes
+// a token source that supports it, such as a *lexer.Lexer, insert the
+// semicolons (see Lexer.InsertSemicolons), and lets a statement followed
+// by a closing brace omit its semicolon, as in `fn() { return 1 }`.
+func WithNewlineSemicolons() Option {
+	return func(p *Parser) {
+		p.newlines = true
+		if l, ok := p.l.(interface{ InsertSemicolons(bool) }); ok {
+			l.InsertSemicolons(true)
+		}
+	}
+}
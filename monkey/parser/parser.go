@@ -1,17 +1,48 @@
+// Package parser builds syntax trees from tokens. Its API follows the
+// needs of the interpreter and its tools, not those of embedders, who
+// should use package monkey.
 package parser
 
 import (
 	"fmt"
+	"io"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
+	"os"
 	"strconv"
 )
 
+// DefaultMaxDepth is the default limit on how deeply expressions may nest.
+// It keeps pathological input such as thousands of nested parentheses from
+// exhausting the stack in the parser or, later, the evaluator.
+const DefaultMaxDepth = 1000
+
 type Parser struct {
-	l      *lexer.Lexer
+	l      lexer.TokenSource
 	errors []string
 	DEBUG  bool
+	arena  *ast.Arena
+
+	// lexErrors counts the errors of the token source already reported.
+	lexErrors int
+
+	// newlines lets statements omit their semicolons before a closing
+	// brace; see WithNewlineSemicolons.
+	newlines bool
+
+	traceOut   io.Writer
+	traceLevel int
+	traceStack []*traceNode // calls being traced for Explain, root first
+
+	// maxErrors stops parsing once this many errors were found. Zero or
+	// less means no limit.
+	maxErrors int
+
+	// maxDepth limits expression nesting; exceeding it aborts parsing with
+	// an error. Zero or less disables the limit.
+	maxDepth int
+	depth    int
 
 	curToken  token.Token
 	peekToken token.Token
@@ -48,16 +79,19 @@ var precedences = map[token.TokenType]int{
 	token.LPAREN:   CALL,
 }
 
-func New(l *lexer.Lexer, debug ...bool) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+// New creates a parser reading tokens from l, which is usually a
+// *lexer.Lexer or a *lexer.TokenStream, configured by opts.
+func New(l lexer.TokenSource, opts ...Option) *Parser {
+	p := &Parser{l: l, errors: []string{}, maxDepth: DefaultMaxDepth, traceOut: os.Stdout}
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 
 	//register prefix fns
 	p.prefixParseFns[token.IDENT] = p.parseIdentifier
 	p.prefixParseFns[token.INT] = p.parseIntegerLiteral
-	p.prefixParseFns[token.BANG] = p.parsePrefixExpression
-	p.prefixParseFns[token.MINUS] = p.parsePrefixExpression
+	for _, op := range prefixOperators {
+		p.prefixParseFns[op] = p.parsePrefixExpression
+	}
 	p.prefixParseFns[token.TRUE] = p.parseBoolean
 	p.prefixParseFns[token.FALSE] = p.parseBoolean
 	p.prefixParseFns[token.LPAREN] = p.parseGroupedExpression
@@ -75,16 +109,30 @@ func New(l *lexer.Lexer, debug ...bool) *Parser {
 	p.infixParseFns[token.NOT_EQ] = p.parseInfixExpression
 	p.infixParseFns[token.LPAREN] = p.parseCallExpression
 
+	for _, opt := range opts {
+		opt(p)
+	}
+
 	p.nextToken()
 	p.nextToken()
 
-	if len(debug) > 1 {
-		return nil
-	} else if len(debug) == 1 {
-		p.DEBUG = debug[0]
+	return p
+}
+
+// NewDebug creates a parser that traces to stdout if debug is set.
+//
+// Deprecated: use New(l, WithTrace(os.Stdout)) instead.
+func NewDebug(l lexer.TokenSource, debug bool) *Parser {
+	if debug {
+		return New(l, WithTrace(os.Stdout))
 	}
+	return New(l)
+}
 
-	return p
+// UseArena makes the parser allocate AST nodes from a instead of
+// individually. Passing nil restores ordinary allocation.
+func (p *Parser) UseArena(a *ast.Arena) {
+	p.arena = a
 }
 
 func (p *Parser) Errors() []string {
@@ -94,12 +142,35 @@ func (p *Parser) Errors() []string {
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	if p.peekToken.Type == token.ILLEGAL {
+		p.addLexErrors()
+	}
 }
 
-func (p *Parser) ParseProgram() *ast.Program {
-	program := &ast.Program{}
+// addLexErrors reports the errors the token source found since the last
+// call, if it explains its ILLEGAL tokens. They do not count towards the
+// maximum number of errors, since tokens are read ahead, before parsing
+// starts or could be aborted; the parse error an ILLEGAL token causes
+// does.
+func (p *Parser) addLexErrors() {
+	src, ok := p.l.(lexer.ErrorSource)
+	if !ok {
+		return
+	}
+	errs := src.Errors()
+	for ; p.lexErrors < len(errs); p.lexErrors++ {
+		p.errors = append(p.errors, errs[p.lexErrors].Error())
+	}
+}
+
+// ParseProgram parses the whole input. If parsing is aborted, the
+// statements parsed so far are returned.
+func (p *Parser) ParseProgram() (program *ast.Program) {
+	program = &ast.Program{}
 	program.Statements = []ast.Statement{}
 
+	defer p.recoverAbort()
+
 	for p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
 		if stmt != nil {
@@ -107,9 +178,48 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	ast.MarkUnbound(program)
 	return program
 }
 
+// errAbort is panicked with to stop parsing at once, for errors after which
+// continuing would only produce a cascade of follow-up errors.
+type errAbort struct {
+	msg string
+}
+
+// addError records a parse error, aborting once the configured maximum
+// number of errors is reached.
+func (p *Parser) addError(msg string) {
+	p.errors = append(p.errors, msg)
+	if p.maxErrors > 0 && len(p.errors) >= p.maxErrors {
+		p.abort("too many errors")
+	}
+}
+
+func (p *Parser) abort(format string, a ...interface{}) {
+	panic(errAbort{msg: fmt.Sprintf(format, a...)})
+}
+
+// recoverAbort is deferred by the parsing entry points. It records the
+// message of an abort; any other Go panic is always a parser bug and is
+// recorded as an internal error at the current token.
+func (p *Parser) recoverAbort() {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if abort, ok := r.(errAbort); ok {
+		p.errors = append(p.errors, abort.msg)
+		return
+	}
+
+	msg := fmt.Sprintf("internal parser error at line %d, column %d: %v",
+		p.curToken.Line, p.curToken.Column, r)
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
@@ -122,13 +232,26 @@ func (p *Parser) parseStatement() ast.Statement {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	letStmt := &ast.LetStatement{Token: p.curToken}
+	letStmt := p.arena.LetStatement(ast.LetStatement{Token: p.curToken})
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	if p.peekTokenIs(token.LPAREN) {
+		// let (a, b) = ...;
+		p.nextToken()
+		letStmt.Names = p.parseFunctionParameters()
+		if letStmt.Names == nil {
+			return nil
+		}
+		if len(letStmt.Names) == 0 {
+			p.addError("Expected at least one name in let (...)")
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	letStmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		letStmt.Name = p.arena.Identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -138,7 +261,16 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	letStmt.Value = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.SEMICOLON) {
+	if p.peekTokenIs(token.ELSE) {
+		// let x = v else { ... };
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		letStmt.Else = p.parseBlockStatement()
+	}
+
+	if !p.expectStatementEnd() {
 		return nil
 	}
 
@@ -146,13 +278,27 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	returnStmt := &ast.ReturnStatement{Token: p.curToken}
+	returnStmt := p.arena.ReturnStatement(ast.ReturnStatement{Token: p.curToken})
 
 	p.nextToken()
 
+	first := p.curToken
 	returnStmt.ReturnValue = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.SEMICOLON) {
+	if p.peekTokenIs(token.COMMA) {
+		// return a, b;
+		tuple := p.arena.TupleLiteral(ast.TupleLiteral{
+			Token: first, Elements: []ast.Expression{returnStmt.ReturnValue},
+		})
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+		}
+		returnStmt.ReturnValue = tuple
+	}
+
+	if !p.expectStatementEnd() {
 		return nil
 	}
 
@@ -161,9 +307,9 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	if p.DEBUG {
-		defer untrace(trace("parseExpressionStatement"))
+		defer p.untrace(p.trace("parseExpressionStatement"))
 	}
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt := p.arena.ExpressionStatement(ast.ExpressionStatement{Token: p.curToken})
 	stmt.Expression = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -175,8 +321,16 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace(fmt.Sprintf("parseExpression: %d", precedence)))
+		defer p.untrace(p.trace(fmt.Sprintf("parseExpression: %d", precedence)))
 	}
+
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.maxDepth > 0 && p.depth > p.maxDepth {
+		p.abort("expression nested too deeply at line %d, column %d (max depth %d)",
+			p.curToken.Line, p.curToken.Column, p.maxDepth)
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 
 	if prefix == nil {
@@ -201,21 +355,22 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 func (p *Parser) parseIdentifier() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseIdentifier"))
+		defer p.untrace(p.trace("parseIdentifier"))
 	}
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return p.arena.Identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseIntegerLiteral"))
+		defer p.untrace(p.trace("parseIntegerLiteral"))
 	}
-	lit := &ast.IntegerLiteral{Token: p.curToken}
+	lit := p.arena.IntegerLiteral(ast.IntegerLiteral{Token: p.curToken})
 
-	i, err := strconv.ParseInt(p.curToken.Literal, 10, 64)
+	digits, base := integerBase(p.curToken.Literal)
+	i, err := strconv.ParseInt(digits, base, 64)
 	if err != nil {
 		msg := fmt.Sprintf("Could not parse %s as an integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(msg)
 		return nil
 	}
 
@@ -224,11 +379,29 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// integerBase splits the radix prefix off an integer literal such as 0x1F
+// and returns the remaining digits and their base. Literals without a
+// prefix, including ones with leading zeros, are decimal.
+func integerBase(lit string) (digits string, base int) {
+	if len(lit) < 2 || lit[0] != '0' {
+		return lit, 10
+	}
+	switch lit[1] {
+	case 'x', 'X':
+		return lit[2:], 16
+	case 'o', 'O':
+		return lit[2:], 8
+	case 'b', 'B':
+		return lit[2:], 2
+	}
+	return lit, 10
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parsePrefixExpression"))
+		defer p.untrace(p.trace("parsePrefixExpression"))
 	}
-	pe := &ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal}
+	pe := p.arena.PrefixExpression(ast.PrefixExpression{Token: p.curToken, Operator: p.curToken.Literal})
 
 	p.nextToken()
 
@@ -239,11 +412,11 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace(fmt.Sprintf("%s:parseInfixExpression", p.curToken.Literal)))
+		defer p.untrace(p.trace(fmt.Sprintf("%s:parseInfixExpression", p.curToken.Literal)))
 	}
-	ie := &ast.InfixExpression{
+	ie := p.arena.InfixExpression(ast.InfixExpression{
 		Token: p.curToken, Left: left, Operator: p.curToken.Literal,
-	}
+	})
 
 	precedence := p.curPrecedence()
 	p.nextToken()
@@ -254,13 +427,13 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 
 func (p *Parser) parseBoolean() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseBoolean"))
+		defer p.untrace(p.trace("parseBoolean"))
 	}
-	be := &ast.Boolean{Token: p.curToken}
+	be := p.arena.Boolean(ast.Boolean{Token: p.curToken})
 
 	if p.curToken.Literal != "true" && p.curToken.Literal != "false" {
 		msg := fmt.Sprintf("Could not parse %s as a Boolean", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(msg)
 		return nil
 	}
 
@@ -272,7 +445,7 @@ func (p *Parser) parseBoolean() ast.Expression {
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseGroupedExpression"))
+		defer p.untrace(p.trace("parseGroupedExpression"))
 	}
 
 	p.nextToken()
@@ -287,7 +460,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseIfExpression"))
+		defer p.untrace(p.trace("parseIfExpression"))
 	}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -295,7 +468,7 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	p.nextToken()
-	ie := &ast.IfExpression{Token: p.curToken}
+	ie := p.arena.IfExpression(ast.IfExpression{Token: p.curToken})
 	ie.Condition = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
@@ -324,10 +497,10 @@ func (p *Parser) parseIfExpression() ast.Expression {
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	// Starts on '{' and ends on '}'
 	if p.DEBUG {
-		defer untrace(trace("parseBlockStatement"))
+		defer p.untrace(p.trace("parseBlockStatement"))
 	}
 
-	bs := &ast.BlockStatement{Token: p.curToken}
+	bs := p.arena.BlockStatement(ast.BlockStatement{Token: p.curToken})
 	bs.Statements = []ast.Statement{}
 
 	p.nextToken()
@@ -345,27 +518,33 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseFunctionLiteral"))
+		defer p.untrace(p.trace("parseFunctionLiteral"))
 	}
 
-	fl := &ast.FunctionLiteral{Token: p.curToken}
+	fl := p.arena.FunctionLiteral(ast.FunctionLiteral{Token: p.curToken})
 
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 
 	fl.Parameters = p.parseFunctionParameters()
+	if fl.Parameters == nil {
+		return nil
+	}
 
-	p.nextToken()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
 
 	fl.Body = p.parseBlockStatement()
+	fl.Captures = ast.FreeVariables(fl)
 
 	return fl
 }
 
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	if p.DEBUG {
-		defer untrace(trace("parseFunctionParameters"))
+		defer p.untrace(p.trace("parseFunctionParameters"))
 	}
 
 	identifiers := []*ast.Identifier{}
@@ -375,15 +554,23 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.arena.Identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
-		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.RPAREN) {
+			// trailing comma
+			break
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ident := p.arena.Identifier(ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 		identifiers = append(identifiers, ident)
 	}
 
@@ -396,17 +583,17 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace(fmt.Sprintf("%s:parseCallExpression", function.String())))
+		defer p.untrace(p.trace(fmt.Sprintf("%s:parseCallExpression", function.String())))
 	}
 
-	ce := &ast.CallExpression{Token: p.curToken, Function: function}
+	ce := p.arena.CallExpression(ast.CallExpression{Token: p.curToken, Function: function})
 	ce.Arguments = p.parseCallArguments()
 	return ce
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
 	if p.DEBUG {
-		defer untrace(trace("parseCallArguments"))
+		defer p.untrace(p.trace("parseCallArguments"))
 	}
 
 	args := []ast.Expression{}
@@ -423,6 +610,10 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
+		if p.peekTokenIs(token.RPAREN) {
+			// trailing comma
+			break
+		}
 		p.nextToken()
 		expr = p.parseExpression(LOWEST)
 		args = append(args, expr)
@@ -453,26 +644,30 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// expectStatementEnd advances to the semicolon ending a let or return
+// statement. With WithNewlineSemicolons, a statement followed by a closing
+// brace or the end of input needs none.
+func (p *Parser) expectStatementEnd() bool {
+	if p.newlines && (p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)) {
+		return true
+	}
+	return p.expectPeek(token.SEMICOLON)
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("Expected next token to be %s. Got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(msg)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.curToken.Type)
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return Precedence(p.peekToken.Type)
 }
@@ -1,9 +1,15 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"monkey/testutil"
+	"monkey/token"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -174,6 +180,44 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestRadixIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0XfF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"0B0", 0},
+		{"007", 7},
+		{"0", 0},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		lit, ok := stmt.Expression.(*ast.IntegerLiteral)
+		if !ok {
+			t.Fatalf("%q: exp not *ast.IntegerLiteral. got=%T", tt.input, stmt.Expression)
+		}
+		if lit.Value != tt.expected || lit.TokenLiteral() != tt.input {
+			t.Errorf("%q: expected %d. got=%d (%s)", tt.input, tt.expected, lit.Value, lit.TokenLiteral())
+		}
+	}
+
+	for _, input := range []string{"0x", "0b102", "0o8", "0xG"} {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected a parse error", input)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -481,6 +525,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 + 2 * 10",
 			"(5 + (2 * 10))",
 		},
+		{
+			"f(1)(2)",
+			"f(1)(2)",
+		},
+		{
+			"f(1)(2)(3, 4)",
+			"f(1)(2)(3, 4)",
+		},
+		{
+			"-f(1)(2)",
+			"(-f(1)(2))",
+		},
+		{
+			"a + f(1)(2) * b",
+			"(a + (f(1)(2) * b))",
+		},
+		{
+			"f(g(1)(2))(h(3))",
+			"f(g(1)(2))(h(3))",
+		},
+		{
+			"(a + b)(c)",
+			"(a + b)(c)",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -692,6 +760,8 @@ func TestFunctionParameterParsing(t *testing.T) {
 		{input: "fn() {};", expectedParams: []string{}},
 		{input: "fn(x) {};", expectedParams: []string{"x"}},
 		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{input: "fn(x,) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z,) {};", expectedParams: []string{"x", "y", "z"}},
 	}
 
 	for _, tt := range tests {
@@ -714,6 +784,29 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionCaptures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"fn() { 1 }", []string{}},
+		{"fn(x, y) { x + y }", []string{}},
+		{"fn(x) { x + y * z }", []string{"y", "z"}},
+		{"fn(x) { let a = b; fn(c) { a + c + d(x) } }", []string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		fl := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+		if fmt.Sprint(fl.Captures) != fmt.Sprint(tt.expected) || fl.Captures == nil {
+			t.Errorf("%q: expected captures %v. got=%v", tt.input, tt.expected, fl.Captures)
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 +5);"
 
@@ -770,6 +863,11 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 			expectedIdent: "add",
 			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
 		},
+		{
+			input:         "add(1, 2 * 3,);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "(2 * 3)"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -803,6 +901,347 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTrailingCommaErrors(t *testing.T) {
+	inputs := []string{
+		"add(,);",
+		"add(1,,);",
+		"fn(,) {};",
+		"fn(x,,) {};",
+		"let (,) = f();",
+		"let x = f() else return 0;",
+		"let x = f() else { return 0; }",
+	}
+
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected a parse error", input)
+		}
+	}
+}
+
+func TestLexErrorsReported(t *testing.T) {
+	for _, src := range []lexer.TokenSource{
+		lexer.New("let x = 1 @ 2;"),
+		lexer.NewTokenStream(lexer.New("let x = 1 @ 2;")),
+	} {
+		p := New(src)
+		p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) == 0 || errs[0] != "illegal character '@' at line 1, column 11" {
+			t.Errorf("expected the lexer's error first. got=%q", errs)
+		}
+	}
+}
+
+func TestParsingWithInsertedSemicolons(t *testing.T) {
+	input := `let max = fn(a, b) {
+  if (a > b) {
+    return a } else {
+    b
+  }
+}
+let (q, r) = divmod(
+  7, 2)
+max(q, r)`
+
+	p := New(lexer.New(input), WithNewlineSemicolons())
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	explicit := `let max = fn(a, b) { if (a > b) { return a; } else { b; } };
+let (q, r) = divmod(7, 2); max(q, r);`
+	expected := New(lexer.New(explicit)).ParseProgram()
+	if program.String() != expected.String() {
+		t.Errorf("expected %q. got=%q", expected.String(), program.String())
+	}
+}
+
+func TestTupleParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"return a, b;", "return a, b;"},
+		{"return 1, 2 + 3, f(x, y);", "return 1, (2 + 3), f(x, y);"},
+		{"let (x, y) = f();", "let (x, y) = f();"},
+		{"let (q) = 1;", "let (q) = 1;"},
+		{"let (x, y,) = f();", "let (x, y) = f();"},
+		{"let x = f() else { return 0; };", "let x = f() else return 0;;"},
+		{"let (x, y) = f() else { return 0; };", "let (x, y) = f() else return 0;;"},
+		{"fn() { return 1, 2; }", "fn()return 1, 2;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("return a, b;"))
+	program := p.ParseProgram()
+	ret := program.Statements[0].(*ast.ReturnStatement)
+	tuple, ok := ret.ReturnValue.(*ast.TupleLiteral)
+	if !ok {
+		t.Fatalf("ReturnValue is not ast.TupleLiteral. got=%T", ret.ReturnValue)
+	}
+	if len(tuple.Elements) != 2 {
+		t.Fatalf("wrong number of elements. got=%d", len(tuple.Elements))
+	}
+	testIdentifier(t, tuple.Elements[0], "a")
+	testIdentifier(t, tuple.Elements[1], "b")
+
+	p = New(lexer.New("let (x, y) = f();"))
+	program = p.ParseProgram()
+	let := program.Statements[0].(*ast.LetStatement)
+	if let.Name != nil || len(let.Names) != 2 {
+		t.Fatalf("expected two names and no Name. got Name=%v, Names=%v", let.Name, let.Names)
+	}
+	testIdentifier(t, let.Names[0], "x")
+	testIdentifier(t, let.Names[1], "y")
+
+	p = New(lexer.New("let () = f();"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for let without names")
+	}
+}
+
+func TestInternalErrorRecovery(t *testing.T) {
+	p := New(lexer.New("let a = 1;\nlet b = boom;"))
+	p.prefixParseFns[token.IDENT] = func() ast.Expression {
+		if p.curToken.Literal == "boom" {
+			panic("parser bug")
+		}
+		return p.parseIdentifier()
+	}
+
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 1 {
+		t.Errorf("expected statements before the panic to be kept. got=%d",
+			len(program.Statements))
+	}
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error. got=%v", p.Errors())
+	}
+	expected := "internal parser error at line 2, column 9: parser bug"
+	if p.Errors()[0] != expected {
+		t.Errorf("wrong error. expected %q, got %q", expected, p.Errors()[0])
+	}
+}
+
+func TestParserOptions(t *testing.T) {
+	var trace bytes.Buffer
+	p := New(lexer.New("-a;"), WithTrace(&trace))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expectedTrace := `BEG parseExpressionStatement
+	BEG parseExpression: 1
+		BEG parsePrefixExpression
+			BEG parseExpression: 6
+				BEG parseIdentifier
+				END parseIdentifier
+			END parseExpression: 6
+		END parsePrefixExpression
+	END parseExpression: 1
+END parseExpressionStatement
+`
+	if trace.String() != expectedTrace {
+		t.Errorf("wrong trace. expected:\n%s\ngot:\n%s", expectedTrace, trace.String())
+	}
+
+	input := "let = 1; let = 2; let = 3; let = 4;"
+	p = New(lexer.New(input), WithMaxErrors(3))
+	p.ParseProgram()
+	if len(p.Errors()) != 4 || p.Errors()[3] != "too many errors" {
+		t.Errorf("expected 3 errors and a final \"too many errors\". got=%q", p.Errors())
+	}
+
+	p = New(lexer.New(input))
+	p.ParseProgram()
+	if len(p.Errors()) != 8 {
+		t.Errorf("expected all 8 errors without a limit. got=%d", len(p.Errors()))
+	}
+
+	arena := ast.NewArena()
+	p = New(lexer.New("x"), WithArena(arena))
+	if p.arena != arena {
+		t.Errorf("WithArena did not set the arena")
+	}
+
+	if p := NewDebug(lexer.New("x"), false); p == nil || p.DEBUG {
+		t.Errorf("NewDebug(l, false) should return a non-tracing parser")
+	}
+}
+
+func TestParsingFromTokenStream(t *testing.T) {
+	input := "let x = 1 + 2;"
+	s := lexer.NewTokenStream(lexer.New(input))
+
+	// look ahead at the first two tokens, then give them back to the parser
+	s.Mark()
+	s.NextToken()
+	if tok := s.NextToken(); tok.Literal != "x" {
+		t.Fatalf("expected to peek at x. got=%q", tok.Literal)
+	}
+	s.Reset()
+
+	p := New(s)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != "let x = (1 + 2);" {
+		t.Errorf("wrong program. got=%q", program.String())
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	nested := func(open, inner, close string, n int) string {
+		return strings.Repeat(open, n) + inner + strings.Repeat(close, n)
+	}
+
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected string
+	}{
+		{nested("(", "1", ")", 100000), DefaultMaxDepth,
+			"expression nested too deeply at line 1, column 1001 (max depth 1000)"},
+		{nested("- ", "1", "", 100000), DefaultMaxDepth,
+			"expression nested too deeply at line 1, column 2001 (max depth 1000)"},
+		{nested("fn() { ", "1", " }", 5000), DefaultMaxDepth,
+			"expression nested too deeply at line 1, column 7001 (max depth 1000)"},
+		{nested("f(", "1", ")", 10), 5,
+			"expression nested too deeply at line 1, column 11 (max depth 5)"},
+		{nested("if (x) { ", "1", " }", 10), 3,
+			"expression nested too deeply at line 1, column 23 (max depth 3)"},
+		{nested("(", "1", ")", 100), 0, ""},
+		{nested("!", "true", "", 999), DefaultMaxDepth, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), WithMaxDepth(tt.maxDepth))
+		p.ParseProgram()
+
+		if tt.expected == "" {
+			checkParserErrors(t, p)
+			continue
+		}
+		if len(p.Errors()) != 1 {
+			t.Errorf("expected exactly 1 error. got=%d", len(p.Errors()))
+			continue
+		}
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong error. expected %q, got %q", tt.expected, p.Errors()[0])
+		}
+	}
+}
+
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"let x = 5;",
+		"((((((1))))))",
+		"fn(x) { fn(y) { fn(z) { x + y + z } } }(1)(2)(3)",
+		"if (a) { if (b) { if (c) { d } } } else { e }",
+		"-!-!-!-!-x",
+		"f(g(h(i(j(k)))))",
+		"return 1, (2, 3;",
+		"let (a, b = f(;",
+		strings.Repeat("(", 2000) + "1" + strings.Repeat(")", 2000),
+		strings.Repeat("fn() { ", 500),
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+
+		for _, msg := range p.Errors() {
+			if strings.HasPrefix(msg, "internal parser error") {
+				t.Fatalf("parser panicked on %q: %s", input, msg)
+			}
+		}
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
+
+func TestParsingWithArena(t *testing.T) {
+	input := `
+let add = fn(x, y) { x + y; };
+let result = add(5, -10 * 2);
+if (result < 0) { return !true; } else { return result == 3; }
+`
+	plain := New(lexer.New(input))
+	want := plain.ParseProgram()
+	checkParserErrors(t, plain)
+
+	arena := ast.NewArena()
+	for i := 0; i < 2; i++ {
+		p := New(lexer.New(input))
+		p.UseArena(arena)
+		got := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if got.String() != want.String() {
+			t.Errorf("arena parse differs. want=%q, got=%q", want.String(), got.String())
+		}
+		arena.Reset()
+	}
+}
+
+func BenchmarkParseProgram(b *testing.B) {
+	src := strings.Repeat(`let add = fn(x, y) { if (x < y) { return x + y; } else { return x * y; } };
+let result = add(five, 10) != -9 == true;
+`, 1000)
+
+	run := func(b *testing.B, arena *ast.Arena) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			p := New(lexer.New(src))
+			p.UseArena(arena)
+			p.ParseProgram()
+			if arena != nil {
+				arena.Reset()
+			}
+		}
+	}
+
+	b.Run("heap", func(b *testing.B) { run(b, nil) })
+	b.Run("arena", func(b *testing.B) { run(b, ast.NewArena()) })
+}
+
+func TestGoldenASTs(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := New(lexer.NewBytes(src))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		testutil.Golden(t, strings.TrimSuffix(path, ".monkey")+".golden", testutil.RenderAST(program))
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	if len(p.Errors()) == 0 {
 		return
@@ -5,28 +5,40 @@ import (
 	"strings"
 )
 
-var traceLevel int = 0
-
 const traceIdentPlaceholder string = "\t"
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+func (p *Parser) identLevel() string {
+	return strings.Repeat(traceIdentPlaceholder, p.traceLevel-1)
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+func (p *Parser) tracePrint(fs string) {
+	fmt.Fprintf(p.traceOut, "%s%s\n", p.identLevel(), fs)
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (p *Parser) incIdent() { p.traceLevel = p.traceLevel + 1 }
+func (p *Parser) decIdent() { p.traceLevel = p.traceLevel - 1 }
+
+// traceNode is a call of a parse function, recorded for Explain.
+type traceNode struct {
+	name     string
+	children []*traceNode
+}
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEG " + msg)
+func (p *Parser) trace(msg string) string {
+	p.incIdent()
+	p.tracePrint("BEG " + msg)
+	if n := len(p.traceStack); n > 0 {
+		node := &traceNode{name: msg}
+		p.traceStack[n-1].children = append(p.traceStack[n-1].children, node)
+		p.traceStack = append(p.traceStack, node)
+	}
 	return msg
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(msg string) {
+	p.tracePrint("END " + msg)
+	p.decIdent()
+	if n := len(p.traceStack); n > 1 {
+		p.traceStack = p.traceStack[:n-1]
+	}
 }
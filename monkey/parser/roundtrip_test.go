@@ -0,0 +1,200 @@
+package parser
+
+import (
+	"fmt"
+	"math/rand"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/testutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// roundTrip checks that formatting the program parsed from input and
+// parsing the result again gives the same tree, and that formatting is
+// stable from then on. Inputs that do not parse are ignored.
+func roundTrip(t *testing.T, input string) {
+	t.Helper()
+
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return
+	}
+
+	formatted := ast.Format(program)
+	p = New(lexer.New(formatted))
+	reparsed := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("formatted program does not parse: %v\ninput:\n%s\nformatted:\n%s", p.Errors(), input, formatted)
+	}
+
+	if want, got := testutil.RenderAST(program), testutil.RenderAST(reparsed); want != got {
+		t.Fatalf("formatting changed the program.\ninput:\n%s\nformatted:\n%s\nwant:\n%s\ngot:\n%s", input, formatted, want, got)
+	}
+	if again := ast.Format(reparsed); again != formatted {
+		t.Fatalf("formatting is not stable.\nfirst:\n%s\nsecond:\n%s", formatted, again)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `let add = fn(x, y) { return x + y * 2; }; if (!add(1, -2)) { let (a, b) = f(); } else {}; -(-a); (fn(x) { x })(1)`
+	expected := `let add = fn(x, y) {
+  return x + (y * 2);
+};
+if (!add(1, -2)) {
+  let (a, b) = f();
+} else {};
+-(-a);
+(fn(x) {
+  x;
+})(1);
+`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if got := ast.Format(program); got != expected {
+		t.Errorf("wrong format.\nwant:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestFormatRoundTripCorpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pattern := range []string{"../eval/testdata/*.monkey", "../spec/*.monkey"} {
+		more, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, more...)
+	}
+
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(path, func(t *testing.T) { roundTrip(t, string(src)) })
+	}
+}
+
+func TestFormatRoundTripGenerated(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		g := &programGenerator{rng: rng}
+		roundTrip(t, g.program(1+rng.Intn(5)))
+	}
+}
+
+func FuzzFormatRoundTrip(f *testing.F) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 20; i++ {
+		g := &programGenerator{rng: rng}
+		f.Add(g.program(3))
+	}
+
+	f.Fuzz(roundTrip)
+}
+
+// programGenerator writes random, syntactically valid Monkey programs.
+type programGenerator struct {
+	rng *rand.Rand
+}
+
+var (
+	genNames     = []string{"a", "b", "x", "y", "f", "add"}
+	genInfixes   = []string{"+", "-", "*", "/", "<", ">", "==", "!="}
+	genPrefixes  = []string{"!", "-"}
+	genMaxNested = 4
+)
+
+func (g *programGenerator) program(n int) string {
+	stmts := []string{}
+	for i := 0; i < n; i++ {
+		stmts = append(stmts, g.statement(0))
+	}
+	return strings.Join(stmts, "\n")
+}
+
+func (g *programGenerator) name() string {
+	return genNames[g.rng.Intn(len(genNames))]
+}
+
+func (g *programGenerator) statement(depth int) string {
+	switch g.rng.Intn(6) {
+	case 0:
+		return fmt.Sprintf("let %s = %s;", g.name(), g.expression(depth))
+	case 4:
+		return fmt.Sprintf("let %s = %s(%s) else %s;", g.name(), g.name(), g.expressions(depth, 1), g.block(depth))
+	case 1:
+		return fmt.Sprintf("let (%s, %s) = %s;", g.name(), g.name(), g.expression(depth))
+	case 2:
+		return fmt.Sprintf("return %s;", g.expressions(depth, 1+g.rng.Intn(2)))
+	default:
+		return g.expression(depth) + ";"
+	}
+}
+
+func (g *programGenerator) block(depth int) string {
+	stmts := []string{}
+	for i := g.rng.Intn(3); i > 0; i-- {
+		stmts = append(stmts, g.statement(depth))
+	}
+	return "{ " + strings.Join(stmts, " ") + " }"
+}
+
+func (g *programGenerator) expressions(depth, n int) string {
+	exprs := []string{}
+	for i := 0; i < n; i++ {
+		exprs = append(exprs, g.expression(depth))
+	}
+	return strings.Join(exprs, ", ")
+}
+
+func (g *programGenerator) expression(depth int) string {
+	depth++
+	choice := g.rng.Intn(10)
+	if depth > genMaxNested {
+		choice = g.rng.Intn(3)
+	}
+
+	switch choice {
+	case 0:
+		return g.name()
+	case 1:
+		return fmt.Sprint(g.rng.Intn(100))
+	case 2:
+		return []string{"true", "false"}[g.rng.Intn(2)]
+	case 3:
+		operand := g.expression(depth)
+		if strings.HasPrefix(operand, "-") {
+			// keep "- -x" from lexing as a decrement
+			operand = " " + operand
+		}
+		return genPrefixes[g.rng.Intn(len(genPrefixes))] + operand
+	case 4, 5:
+		op := genInfixes[g.rng.Intn(len(genInfixes))]
+		return g.expression(depth) + " " + op + " " + g.expression(depth)
+	case 6:
+		return "(" + g.expression(depth) + ")"
+	case 7:
+		return fmt.Sprintf("%s(%s)", g.name(), g.expressions(depth, g.rng.Intn(3)))
+	case 8:
+		params := []string{}
+		for i := g.rng.Intn(3); i > 0; i-- {
+			params = append(params, g.name())
+		}
+		return fmt.Sprintf("fn(%s) %s", strings.Join(params, ", "), g.block(depth))
+	default:
+		s := fmt.Sprintf("if (%s) %s", g.expression(depth), g.block(depth))
+		if g.rng.Intn(2) == 0 {
+			s += " else " + g.block(depth)
+		}
+		return s
+	}
+}
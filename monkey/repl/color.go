@@ -0,0 +1,150 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/highlight"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
+)
+
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[1;31m"
+	colorYellow  = "\033[33m"
+	colorMagenta = "\033[35m"
+	colorCyan    = "\033[36m"
+	colorGray    = "\033[90m"
+)
+
+var valueColors = map[object.ObjectType]string{
+	object.INTEGER_OBJ: colorCyan,
+	object.BOOLEAN_OBJ: colorYellow,
+	object.NULL_OBJ:    colorGray,
+	object.BUILTIN_OBJ: colorMagenta,
+}
+
+// printer writes REPL output, highlighting it with ANSI colors when out is
+// a terminal and NO_COLOR is not set.
+type printer struct {
+	out   io.Writer
+	color bool
+}
+
+func newPrinter(out io.Writer) *printer {
+	return &printer{out: out, color: useColor(out)}
+}
+
+// useColor reports whether out is a terminal and the user has not opted out
+// of colors through NO_COLOR (https://no-color.org).
+func useColor(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *printer) paint(color, s string) string {
+	if !p.color || color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// printValue prints the result of an evaluation, within limits. For
+// errors, the kind of error in front of the first colon is highlighted.
+func (p *printer) printValue(obj object.Object, limits object.InspectLimits) {
+	if obj.Type() == object.ERROR_OBJ {
+		msg := limits.Inspect(obj)
+		if kind, rest, ok := strings.Cut(msg, ":"); ok {
+			msg = p.paint(colorRed, kind+":") + rest
+		} else {
+			msg = p.paint(colorRed, msg)
+		}
+		io.WriteString(p.out, msg+"\n")
+		return
+	}
+
+	if obj.Type() == object.FUNCTION_OBJ {
+		io.WriteString(p.out, p.highlight(limits.Inspect(obj))+"\n")
+		return
+	}
+	io.WriteString(p.out, p.paint(valueColors[obj.Type()], limits.Inspect(obj))+"\n")
+}
+
+var spanColors = map[highlight.Class]string{
+	highlight.Keyword: colorMagenta,
+	highlight.Number:  colorCyan,
+	highlight.String:  colorYellow,
+	highlight.Comment: colorGray,
+	highlight.Illegal: colorRed,
+}
+
+// highlight colors the tokens of the Monkey source src.
+func (p *printer) highlight(src string) string {
+	if !p.color {
+		return src
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, span := range highlight.Spans([]byte(src)) {
+		out.WriteString(src[last:span.Start])
+		out.WriteString(p.paint(spanColors[span.Class], src[span.Start:span.End]))
+		last = span.End
+	}
+	out.WriteString(src[last:])
+	return out.String()
+}
+
+func (p *printer) printParserErrors(errors []string) {
+	io.WriteString(p.out, MONKEY_FACE)
+	io.WriteString(p.out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(p.out, p.paint(colorRed, " parser errors:")+"\n")
+	for _, msg := range errors {
+		io.WriteString(p.out, "\t"+msg+"\n")
+	}
+}
+
+// printCarets shows where in src each lexer error occurred: the line of
+// the error with a caret under the offending character.
+func (p *printer) printCarets(src string, errs []lexer.LexError) {
+	lines := strings.Split(src, "\n")
+	for _, e := range errs {
+		if e.Line < 1 || e.Line > len(lines) {
+			continue
+		}
+		line := lines[e.Line-1]
+		pad := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, line[:min(e.Column-1, len(line))])
+		io.WriteString(p.out, "\t"+line+"\n\t"+pad+p.paint(colorRed, "^")+"\n")
+	}
+}
+
+// printTokens lists the tokens of src with their positions, coloring each
+// token type like the highlighter colors the token.
+func (p *printer) printTokens(src string) {
+	l := lexer.New(src)
+	l.EmitComments(true)
+	l.Tokens()(func(tok token.Token) bool {
+		typ := p.paint(spanColors[highlight.Classify(tok)], fmt.Sprintf("%-12s", tok.Type))
+		fmt.Fprintf(p.out, "%d:%d\t%s %q\n", tok.Line, tok.Column, typ, tok.Literal)
+		return true
+	})
+}
@@ -1,17 +1,53 @@
+// Package repl implements the interactive Monkey console. Start runs it on
+// standard streams the way the monkey command does; hosts that embed a
+// console, for instance over a network connection, create a REPL with New,
+// adjust its fields and register their own commands before calling Run.
 package repl
 
 import (
 	"bufio"
-	"fmt"
+	"context"
 	"io"
+	"monkey/ast"
 	"monkey/eval"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
 )
 
 const PROMPT = ">> "
 
+// PASTE_COMMAND switches the REPL into paste mode, in which lines are
+// collected until a lone PASTE_END (or end of input) and then evaluated as
+// a single program.
+const (
+	PASTE_COMMAND = ":paste"
+	PASTE_END     = "."
+)
+
+// DOC_COMMAND, followed by the name of a builtin, prints its signature and
+// documentation. On its own it lists the builtins.
+const DOC_COMMAND = ":doc"
+
+// FULL_COMMAND prints the last result again without the REPL's Limits.
+const FULL_COMMAND = ":full"
+
+// EXPLAIN_COMMAND, followed by an expression, shows how the parser groups
+// it; see parser.Explain.
+const EXPLAIN_COMMAND = ":explain"
+
+// TOKENS_COMMAND, followed by source, lists the tokens the lexer makes of
+// it.
+const TOKENS_COMMAND = ":tokens"
+
+// HELP_COMMAND lists the available commands.
+const HELP_COMMAND = ":help"
+
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -25,40 +61,260 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
+// Command implements a REPL command such as :doc. It is called with the
+// words that follow the command's name on the input line.
+type Command struct {
+	Help string
+	Run  func(r *REPL, args []string)
+}
+
+// REPL reads Monkey source line by line from In, evaluates it in Env and
+// writes the results to Out. Lines starting with the name of a registered
+// command run that command instead. Fields may be changed until Run or
+// Eval is first called.
+type REPL struct {
+	Prompt string
+	In     io.Reader
+	Out    io.Writer
+
+	// Env holds the session's bindings. Give several REPLs clones of one
+	// snapshot to start them from a shared prelude.
+	Env *object.Environment
+
+	// Context bounds every evaluation; it may carry eval.WithStats and
+	// the like. Defaults to context.Background().
+	Context context.Context
+
+	// Signals makes SIGINT cancel the running evaluation instead of ending
+	// the process. Only a REPL on the process's own terminal should set it.
+	Signals bool
+
+	// Timeout, if positive, bounds each evaluation on its own.
+	Timeout time.Duration
+
+	// Limits bounds how much of each result is printed. Defaults to
+	// object.DefaultInspectLimits.
+	Limits object.InspectLimits
+
+	// Semicolons ends statements at line ends, so that input such as
+	// `return x` needs no semicolon; see parser.WithNewlineSemicolons.
+	Semicolons bool
+
+	commands map[string]Command
+	scanner  *bufio.Scanner
+	printer  *printer
+	names    *lexer.Names
+	eof      bool
+	last     object.Object
+}
+
+// New returns a REPL on in and out with a fresh environment and the
+// standard commands registered.
+func New(in io.Reader, out io.Writer) *REPL {
+	r := &REPL{
+		Prompt:   PROMPT,
+		In:       in,
+		Out:      out,
+		Env:      object.NewEnvironment(),
+		Context:  context.Background(),
+		Limits:   object.DefaultInspectLimits,
+		commands: map[string]Command{},
+		names:    lexer.NewNames(),
+	}
+	r.Handle(PASTE_COMMAND, Command{Help: "evaluate several lines at once", Run: pasteCommand})
+	r.Handle(DOC_COMMAND, Command{Help: "document builtins: " + DOC_COMMAND + " [name...]", Run: docCommand})
+	r.Handle(FULL_COMMAND, Command{Help: "print the last result in full", Run: fullCommand})
+	r.Handle(EXPLAIN_COMMAND, Command{Help: "show how an expression is parsed: " + EXPLAIN_COMMAND + " expr", Run: explainCommand})
+	r.Handle(TOKENS_COMMAND, Command{Help: "list the tokens of source: " + TOKENS_COMMAND + " src", Run: tokensCommand})
+	r.Handle(HELP_COMMAND, Command{Help: "list commands", Run: helpCommand})
+	return r
+}
+
+// Start runs a REPL on in and out until the input ends, with SIGINT
+// cancelling evaluations.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	r := New(in, out)
+	r.Signals = true
+	r.Run()
+}
 
-	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+// Handle registers cmd under name, which includes the leading colon,
+// replacing any command of that name.
+func (r *REPL) Handle(name string, cmd Command) {
+	r.commands[name] = cmd
+}
+
+// Run reads and handles lines until In ends.
+func (r *REPL) Run() {
+	for !r.eof {
+		io.WriteString(r.Out, r.Prompt)
+		line, ok := r.ReadLine()
+		if !ok {
 			return
 		}
 
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+		if fields := strings.Fields(line); len(fields) > 0 {
+			if cmd, ok := r.commands[fields[0]]; ok {
+				cmd.Run(r, fields[1:])
+				continue
+			}
+		}
 
-		if len(p.Errors()) > 0 {
-			printParserErrors(out, p.Errors())
-			continue
+		r.Eval(line)
+	}
+}
+
+// ReadLine reads the next line of input, for commands that take more than
+// one line. It reports false once In has ended, which also ends Run.
+func (r *REPL) ReadLine() (string, bool) {
+	if r.scanner == nil {
+		r.scanner = bufio.NewScanner(r.In)
+	}
+	if !r.scanner.Scan() {
+		r.eof = true
+		return "", false
+	}
+	return r.scanner.Text(), true
+}
+
+// Eval parses and evaluates src in Env and prints the outcome.
+// Identifiers are interned for the lifetime of the REPL.
+func (r *REPL) Eval(src string) {
+	l := lexer.New(src)
+	l.UseNames(r.names)
+	var opts []parser.Option
+	if r.Semicolons {
+		opts = append(opts, parser.WithNewlineSemicolons())
+	}
+	p := parser.New(l, opts...)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		r.output().printParserErrors(p.Errors())
+		r.output().printCarets(src, l.Errors())
+		return
+	}
+
+	evaluated := r.evalProgram(program)
+	if evaluated == eval.NULL && !endsInExpression(program) {
+		return
+	}
+	if evaluated != nil {
+		r.last = evaluated
+		r.output().printValue(evaluated, r.Limits)
+	}
+}
+
+// endsInExpression reports whether the last statement of program is an
+// expression statement, whose value is worth printing even if it is null.
+func endsInExpression(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	_, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func (r *REPL) output() *printer {
+	if r.printer == nil {
+		r.printer = newPrinter(r.Out)
+	}
+	return r.printer
+}
+
+// evalProgram evaluates program. With Signals set, a SIGINT arriving while
+// it runs cancels it so that control returns to the prompt; outside of
+// evaluation, SIGINT keeps its default behaviour of ending the process.
+func (r *REPL) evalProgram(program *ast.Program) object.Object {
+	ctx, cancel := context.WithCancel(r.Context)
+	defer cancel()
+	if r.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	if r.Signals {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		defer signal.Stop(sigs)
+
+		go func() {
+			select {
+			case <-sigs:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	return eval.EvalContext(ctx, program, r.Env)
+}
+
+// pasteCommand reads lines until a lone PASTE_END or the end of input and
+// evaluates them as one program.
+func pasteCommand(r *REPL, args []string) {
+	io.WriteString(r.Out, "// entering paste mode, end with a lone '"+PASTE_END+"' or Ctrl-D\n")
+
+	lines := []string{}
+	for {
+		line, ok := r.ReadLine()
+		if !ok || strings.TrimSpace(line) == PASTE_END {
+			break
 		}
+		lines = append(lines, line)
+	}
+	r.Eval(strings.Join(lines, "\n"))
+}
 
-		evaluated := eval.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+// docCommand prints the documentation of the builtins named in args, or a
+// list of all builtins if there are none.
+func docCommand(r *REPL, args []string) {
+	p := r.output()
+	if len(args) == 0 {
+		io.WriteString(p.out, "builtins: "+strings.Join(eval.BuiltinNames(), ", ")+"\n")
+		return
+	}
+
+	for _, name := range args {
+		b, ok := eval.LookupBuiltin(name)
+		if !ok {
+			io.WriteString(p.out, p.paint(colorRed, "no builtin named "+name)+"\n")
+			continue
 		}
+		io.WriteString(p.out, p.paint(colorMagenta, b.Signature)+"\n    "+b.Doc+"\n")
+	}
+}
+
+// fullCommand prints the last result with no limits on its size.
+func fullCommand(r *REPL, args []string) {
+	if r.last == nil {
+		io.WriteString(r.Out, "no result to print\n")
+		return
+	}
+	r.output().printValue(r.last, object.InspectLimits{})
+}
+
+// explainCommand explains how the expression made up of args is parsed.
+func explainCommand(r *REPL, args []string) {
+	p := r.output()
+	if err := parser.Explain(p.out, strings.Join(args, " ")); err != nil {
+		io.WriteString(p.out, p.paint(colorRed, err.Error())+"\n")
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, MONKEY_FACE)
-	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// tokensCommand lists the tokens of the source made up of args.
+func tokensCommand(r *REPL, args []string) {
+	r.output().printTokens(strings.Join(args, " "))
+}
+
+func helpCommand(r *REPL, args []string) {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		io.WriteString(r.Out, name+"\t"+r.commands[name].Help+"\n")
 	}
 }
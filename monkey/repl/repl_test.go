@@ -0,0 +1,140 @@
+package repl
+
+import (
+	"bytes"
+	"monkey/lexer"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedREPL(t *testing.T) {
+	input := `let x = 20;
+x + 1
+:paste
+let y = x * 2;
+y + 2
+.
+:answer twice
+1 +
+`
+	var out bytes.Buffer
+	r := New(strings.NewReader(input), &out)
+	r.Prompt = "> "
+	r.Handle(":answer", Command{Help: "print the answer", Run: func(r *REPL, args []string) {
+		r.Env.Set("answer", &object.Integer{Value: 42})
+		r.Eval("answer")
+		r.Out.Write([]byte(strings.Join(args, " ") + "\n"))
+	}})
+	r.Run()
+
+	got := out.String()
+	for _, want := range []string{
+		"> > 21\n",
+		"// entering paste mode",
+		"42\n",
+		"> 42\ntwice\n",
+		"no prefix parse function for EOF found",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "null") {
+		t.Errorf("output prints null after a let statement:\n%s", got)
+	}
+	if strings.Contains(got, "\033[") {
+		t.Errorf("output to a buffer is colored:\n%s", got)
+	}
+}
+
+func TestFullCommand(t *testing.T) {
+	input := `:full
+fn() { return 1, 2, 3, 4; }()
+:full
+`
+	var out bytes.Buffer
+	r := New(strings.NewReader(input), &out)
+	r.Prompt = "> "
+	r.Limits = object.InspectLimits{MaxElements: 2}
+	r.Run()
+
+	expected := "> no result to print\n> (1, 2, ... 2 more)\n> (1, 2, 3, 4)\n> "
+	if got := out.String(); got != expected {
+		t.Errorf("expected %q. got=%q", expected, got)
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	var out bytes.Buffer
+	r := New(strings.NewReader(":explain a  -  b\n:explain let\n"), &out)
+	r.Prompt = "> "
+	r.Run()
+
+	got := out.String()
+	if !strings.Contains(got, "parenthesized:\n    (a - b)\n") {
+		t.Errorf("expected the parenthesized expression. got=%q", got)
+	}
+	if !strings.HasSuffix(got, "> Expected next token to be IDENT. Got EOF instead\n> ") {
+		t.Errorf("expected the parse error of `let`. got=%q", got)
+	}
+}
+
+func TestSemicolons(t *testing.T) {
+	input := "let f = fn(x) { return x * 2 }\n:paste\nlet y = f(\n  21)\ny\n.\n"
+	var out bytes.Buffer
+	r := New(strings.NewReader(input), &out)
+	r.Prompt = "> "
+	r.Semicolons = true
+	r.Run()
+
+	expected := "> > // entering paste mode, end with a lone '.' or Ctrl-D\n42\n> "
+	if out.String() != expected {
+		t.Errorf("expected %q. got=%q", expected, out.String())
+	}
+}
+
+func TestTokensCommand(t *testing.T) {
+	var out bytes.Buffer
+	r := New(strings.NewReader(":tokens let x = 1\n"), &out)
+	r.Prompt = "> "
+	r.Run()
+
+	expected := "> 1:1\tLET          \"let\"\n1:5\tIDENT        \"x\"\n1:7\t=            \"=\"\n1:9\tINT          \"1\"\n> "
+	if got := out.String(); got != expected {
+		t.Errorf("expected %q. got=%q", expected, got)
+	}
+}
+
+func TestColoredOutput(t *testing.T) {
+	var out bytes.Buffer
+	p := &printer{out: &out, color: true}
+
+	p.printValue(&object.Integer{Value: 5}, object.DefaultInspectLimits)
+	p.printValue(&object.Error{Message: "type mismatch: INTEGER + BOOLEAN"}, object.DefaultInspectLimits)
+	p.printTokens("if 1")
+	p.printCarets("let a = 1 @ 2;", []lexer.LexError{{Char: '@', Line: 1, Column: 11}})
+
+	expected := colorCyan + "5" + colorReset + "\n" +
+		colorRed + "type mismatch:" + colorReset + " INTEGER + BOOLEAN\n" +
+		"1:1\t" + colorMagenta + "IF          " + colorReset + " \"if\"\n" +
+		"1:4\t" + colorCyan + "INT         " + colorReset + " \"1\"\n" +
+		"\tlet a = 1 @ 2;\n\t          " + colorRed + "^" + colorReset + "\n"
+	if got := out.String(); got != expected {
+		t.Errorf("expected %q. got=%q", expected, got)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	p := &printer{color: true}
+	got := p.highlight("fn(x) { x + 1 }")
+	expected := colorMagenta + "fn" + colorReset + "(x) { x + " + colorCyan + "1" + colorReset + " }"
+	if got != expected {
+		t.Errorf("expected %q. got=%q", expected, got)
+	}
+
+	p.color = false
+	if got := p.highlight("fn(x) { x }"); got != "fn(x) { x }" {
+		t.Errorf("highlighted without color: %q", got)
+	}
+}
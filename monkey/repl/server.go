@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// AUTH_PROMPT is sent to every client of a Server, which must answer with
+// the server's token on a line of its own before it gets a prompt.
+const AUTH_PROMPT = "token: "
+
+// DefaultAuthTimeout is how long a Server with no AuthTimeout waits for a
+// client to send its token.
+const DefaultAuthTimeout = 10 * time.Second
+
+// maxTokenLine bounds the line a client sends as its token.
+const maxTokenLine = 1024
+
+// Server serves REPL sessions over network connections, so that a running
+// program embedding Monkey can be inspected live. Each connection gets a
+// REPL of its own, run on the connection once the client has sent Token.
+type Server struct {
+	// Token authenticates clients. Serve refuses to run without one.
+	Token string
+
+	// Timeout bounds every evaluation of a session, so that a client
+	// cannot keep the host busy with a runaway loop. Zero means no limit.
+	Timeout time.Duration
+
+	// AuthTimeout bounds the time a client has to send Token. Zero means
+	// DefaultAuthTimeout.
+	AuthTimeout time.Duration
+
+	// Setup, if set, prepares each session's REPL before it runs, for
+	// instance to give it a clone of the host's environment or to remove
+	// commands that should not be reachable remotely.
+	Setup func(r *REPL)
+}
+
+// Serve accepts connections on ln and serves a session on each of them
+// until ln is closed.
+func (s *Server) Serve(ln net.Listener) error {
+	if s.Token == "" {
+		return errors.New("repl: server has no token")
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn authenticates the client on conn and runs a REPL for it. The
+// reader used for the token line is handed on to the REPL so that input
+// the client sent ahead of the prompt is not lost. A client that does not
+// send a token line of at most maxTokenLine bytes within AuthTimeout is
+// disconnected.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	timeout := s.AuthTimeout
+	if timeout <= 0 {
+		timeout = DefaultAuthTimeout
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	in := bufio.NewReaderSize(conn, maxTokenLine)
+	io.WriteString(conn, AUTH_PROMPT)
+	line, err := in.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		io.WriteString(conn, "authentication failed\n")
+		return
+	}
+	if err != nil && err != io.EOF {
+		return
+	}
+	token := strings.TrimRight(string(line), "\r\n")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		io.WriteString(conn, "authentication failed\n")
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	r := New(in, conn)
+	r.Timeout = s.Timeout
+	if s.Setup != nil {
+		s.Setup(r)
+	}
+	r.Run()
+}
@@ -0,0 +1,116 @@
+package repl
+
+import (
+	"io"
+	"monkey/object"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer ln.Close()
+
+	s := &Server{
+		Token:   "secret",
+		Timeout: 50 * time.Millisecond,
+		Setup: func(r *REPL) {
+			r.Env.Set("answer", &object.Integer{Value: 42})
+		},
+	}
+	go s.Serve(ln)
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"secret\nanswer + 1\nlet f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(40)\n",
+			[]string{AUTH_PROMPT + ">> 43\n", "evaluation cancelled: context deadline exceeded"},
+		},
+		{
+			"wrong\nanswer\n",
+			[]string{AUTH_PROMPT + "authentication failed\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		io.WriteString(conn, tt.input)
+		conn.(*net.TCPConn).CloseWrite()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		out, err := io.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		got := string(out)
+		for _, want := range tt.expected {
+			if !strings.Contains(got, want) {
+				t.Errorf("output for %q does not contain %q:\n%s", tt.input, want, got)
+			}
+		}
+		if strings.HasPrefix(tt.input, "wrong") && strings.Contains(got, "42") {
+			t.Errorf("unauthenticated client got a session:\n%s", got)
+		}
+	}
+}
+
+func TestServerAuthTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer ln.Close()
+
+	s := &Server{Token: "secret", AuthTimeout: 50 * time.Millisecond}
+	go s.Serve(ln)
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+
+	conn := dial()
+	out, err := io.ReadAll(conn)
+	conn.Close()
+	if err != nil {
+		t.Fatalf("silent client was not disconnected: %v", err)
+	}
+	if string(out) != AUTH_PROMPT {
+		t.Errorf("expected only the prompt. got=%q", out)
+	}
+
+	// the server hangs up on an overlong token line without reading it
+	// all, so the connection may be reset rather than closed
+	conn = dial()
+	io.WriteString(conn, strings.Repeat("secret", 500)+"\n1 + 1\n")
+	out, err = io.ReadAll(conn)
+	conn.Close()
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		t.Fatalf("client with an overlong token was not disconnected")
+	}
+	if strings.Contains(string(out), ">>") {
+		t.Errorf("client with an overlong token got a session:\n%s", out)
+	}
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	s := &Server{}
+	if err := s.Serve(nil); err == nil {
+		t.Fatal("Serve without a token did not fail")
+	}
+}
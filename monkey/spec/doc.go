@@ -0,0 +1,10 @@
+// Package spec is the language conformance corpus. Every .monkey program
+// in this directory is paired with a .golden file holding the result it
+// must evaluate to, rendered by testutil.RenderObject. The tests run each
+// program through every engine and fail if any of them disagrees with the
+// golden result, so new engines and engine changes are checked against the
+// same expectations.
+//
+// To add a case, write the program and run `go test ./spec -update`, then
+// review the generated golden file.
+package spec
@@ -0,0 +1,157 @@
+package spec
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/eval"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/optimize"
+	"monkey/parser"
+	"monkey/testutil"
+	"monkey/transpile"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// engine evaluates a parsed program in a fresh environment.
+type engine struct {
+	name string
+	run  func(program *ast.Program) object.Object
+}
+
+// engines lists the engines checked against the corpus. The first one
+// produces the golden files when run with -update.
+var engines = []engine{
+	{"eval", func(program *ast.Program) object.Object {
+		return eval.Eval(program, object.NewEnvironment())
+	}},
+	{"optimized eval", func(program *ast.Program) object.Object {
+		// The pass rewrites the tree, so work on a copy.
+		program = parser.New(lexer.New(ast.Format(program))).ParseProgram()
+		optimize.PropagateConstants(program)
+		return eval.Eval(program, object.NewEnvironment())
+	}},
+}
+
+func TestConformance(t *testing.T) {
+	paths, err := filepath.Glob("*.monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("empty corpus")
+	}
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(path, ".monkey"), func(t *testing.T) {
+			src, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := parser.New(lexer.NewBytes(src))
+			program := p.ParseProgram()
+			if len(p.Errors()) > 0 {
+				t.Fatalf("parse errors: %v", p.Errors())
+			}
+
+			golden := strings.TrimSuffix(path, ".monkey") + ".golden"
+			reference := engines[0].run(program)
+			testutil.Golden(t, golden, testutil.RenderObject(reference))
+
+			for _, e := range engines[1:] {
+				if diff := object.Diff(reference, e.run(program)); diff != "" {
+					t.Errorf("%s diverges from %s:\n%s", e.name, engines[0].name, diff)
+				}
+			}
+		})
+	}
+}
+
+// TestTranspiledConformance runs the corpus through package transpile. The
+// programs are translated into the functions of one Go command, which is
+// built with the go tool and prints each result; the results must match
+// the golden files. A runaway recursion, whose trace lacks the positions
+// the evaluator reports, must stop at the limit on nested calls too.
+func TestTranspiledConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a Go program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := filepath.Glob("*.monkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var src strings.Builder
+	src.WriteString("package main\n\nimport (\n\"context\"\n\"fmt\"\n\"monkey/eval\"\n\"monkey/object\"\n\"monkey/testutil\"\n)\n\n")
+	src.WriteString("var _ = eval.NULL\n\nfunc main() {\n")
+	for i := range paths {
+		fmt.Fprintf(&src, "fmt.Print(testutil.RenderObject(p%d(context.Background(), object.NewEnvironment())), %q)\n", i, separator)
+	}
+	fmt.Fprintf(&src, "fmt.Print(testutil.RenderObject(deep(context.Background(), object.NewEnvironment())), %q)\n", separator)
+	src.WriteString("}\n\n")
+	deep, err := transpile.Func("deep", parser.New(lexer.New("let f = fn(n) { f(n + 1) }; f(0)")).ParseProgram())
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.Write(deep)
+	src.WriteString("\n")
+	for i, path := range paths {
+		program, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn, err := transpile.Func(fmt.Sprintf("p%d", i), parser.New(lexer.NewBytes(program)).ParseProgram())
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		src.Write(fn)
+		src.WriteString("\n")
+	}
+
+	dir := t.TempDir()
+	goMod := "module transpiled\n\ngo 1.22.0\n\nrequire monkey v0.0.0\n\nreplace monkey => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goTool, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("running transpiled corpus: %v\n%s", err, out)
+	}
+
+	results := strings.Split(string(out), separator)
+	for i, path := range paths {
+		golden, err := os.ReadFile(strings.TrimSuffix(path, ".monkey") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if results[i] != string(golden) {
+			t.Errorf("%s: transpiled program diverges from the golden result:\n%s\ngot:\n%s", path, golden, results[i])
+		}
+	}
+	if deep := results[len(paths)]; !strings.HasPrefix(deep, "ERROR_OBJ maximum call depth 10000 exceeded\n") {
+		t.Errorf("transpiled runaway recursion did not stop at the call depth limit:\n%s", deep)
+	}
+}
+
+// separator ends each result printed by the transpiled corpus.
+const separator = "\x00"
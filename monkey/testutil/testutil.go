@@ -0,0 +1,98 @@
+// Package testutil renders ASTs and objects to canonical text and compares
+// them against golden files, so test suites can assert on whole trees and
+// results instead of hand-written struct checks.
+//
+// Run a package's tests with -update (e.g. `go test ./parser -update`) to
+// rewrite its golden files from the current output.
+package testutil
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with current output")
+
+// RenderAST renders node as an indented tree, one node per line, with the
+// node's own value (identifier name, literal, operator) after its type.
+func RenderAST(node ast.Node) string {
+	var out bytes.Buffer
+	renderNode(&out, node, 0)
+	return out.String()
+}
+
+func renderNode(out *bytes.Buffer, node ast.Node, depth int) {
+	out.WriteString(strings.Repeat("  ", depth))
+	out.WriteString(strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+
+	switch n := node.(type) {
+	case *ast.Identifier:
+		out.WriteString(" " + n.Value)
+	case *ast.IntegerLiteral:
+		fmt.Fprintf(out, " %d", n.Value)
+	case *ast.Boolean:
+		fmt.Fprintf(out, " %t", n.Value)
+	case *ast.PrefixExpression:
+		out.WriteString(" " + n.Operator)
+	case *ast.InfixExpression:
+		out.WriteString(" " + n.Operator)
+	}
+	out.WriteString("\n")
+
+	for _, child := range children(node) {
+		renderNode(out, child, depth+1)
+	}
+}
+
+func children(node ast.Node) []ast.Node {
+	nodes := []ast.Node{}
+	ast.Walk(node, func(n ast.Node) bool {
+		if n == node {
+			return true
+		}
+		nodes = append(nodes, n)
+		return false
+	})
+	return nodes
+}
+
+// RenderObject renders obj as its type followed by its inspected value.
+func RenderObject(obj object.Object) string {
+	if obj == nil {
+		return "<nil>\n"
+	}
+	return fmt.Sprintf("%s %s\n", obj.Type(), obj.Inspect())
+}
+
+// Golden compares got with the contents of the golden file at path, which
+// is relative to the calling test's package directory. With -update, the
+// file is (re)written instead.
+func Golden(t testing.TB, path string, got string) {
+	t.Helper()
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("could not create golden directory: %s", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("could not update golden file: %s", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden file (run with -update to create it): %s", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s does not match.\nwant:\n%s\ngot:\n%s", path, want, got)
+	}
+}
@@ -0,0 +1,123 @@
+package token
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var builtinKeywords = map[string]TokenType{
+	"fn":     FUNCTION,
+	"let":    LET,
+	"true":   TRUE,
+	"false":  FALSE,
+	"if":     IF,
+	"else":   ELSE,
+	"return": RETURN,
+}
+
+// keywordTable maps keywords to their token types and back; the reverse
+// map lets the lexer hand out keyword literals without allocating.
+type keywordTable struct {
+	types    map[string]TokenType
+	literals map[TokenType]string
+}
+
+func newKeywordTable(types map[string]TokenType) *keywordTable {
+	t := &keywordTable{types: types, literals: map[TokenType]string{}}
+	for lit, tok := range types {
+		t.literals[tok] = lit
+	}
+	return t
+}
+
+// keywords holds the current table; writers swap in a new one under keywordsMu.
+var (
+	keywordsMu sync.Mutex
+	keywords   atomic.Pointer[keywordTable]
+)
+
+func init() {
+	keywords.Store(newKeywordTable(builtinKeywords))
+}
+
+// RegisterKeyword makes literal a keyword lexed as a token of type t, as in
+// RegisterKeyword("while", WHILE), so that experiments can extend the
+// language without changing this package. Keywords registered after a
+// lexer started take effect from its next identifier on.
+func RegisterKeyword(literal string, t TokenType) error {
+	keywordsMu.Lock()
+	defer keywordsMu.Unlock()
+
+	old := keywords.Load()
+	if literal == "" || t == "" {
+		return fmt.Errorf("keyword needs a literal and a token type")
+	}
+	if _, ok := old.types[literal]; ok {
+		return fmt.Errorf("%q is already a keyword", literal)
+	}
+	if lit, ok := old.literals[t]; ok {
+		return fmt.Errorf("token type %s is already the keyword %q", t, lit)
+	}
+
+	types := map[string]TokenType{literal: t}
+	for lit, tok := range old.types {
+		types[lit] = tok
+	}
+	keywords.Store(newKeywordTable(types))
+	return nil
+}
+
+// KeywordSnapshot is the keyword table at some point, to be restored later.
+type KeywordSnapshot struct {
+	table *keywordTable
+}
+
+// SnapshotKeywords returns the current keyword table. Tests that register
+// keywords restore it when they are done:
+//
+//	defer token.RestoreKeywords(token.SnapshotKeywords())
+func SnapshotKeywords() KeywordSnapshot {
+	return KeywordSnapshot{table: keywords.Load()}
+}
+
+// RestoreKeywords makes s the keyword table again. The zero snapshot
+// stands for Monkey's own keywords.
+func RestoreKeywords(s KeywordSnapshot) {
+	keywordsMu.Lock()
+	defer keywordsMu.Unlock()
+
+	if s.table == nil {
+		s.table = newKeywordTable(builtinKeywords)
+	}
+	keywords.Store(s.table)
+}
+
+// ResetKeywords removes every registered keyword, leaving Monkey's own.
+func ResetKeywords() {
+	RestoreKeywords(KeywordSnapshot{})
+}
+
+func LookupIdent(ident string) TokenType {
+	if tok, ok := keywords.Load().types[ident]; ok {
+		return tok
+	}
+	return IDENT
+}
+
+// LookupKeyword is the allocation-free counterpart of LookupIdent for
+// callers holding raw source bytes. It returns the keyword's token type and
+// canonical literal, or ok=false if ident is not a keyword.
+func LookupKeyword(ident []byte) (tok TokenType, literal string, ok bool) {
+	table := keywords.Load()
+	if tok, ok = table.types[string(ident)]; ok {
+		return tok, table.literals[tok], true
+	}
+	return IDENT, "", false
+}
+
+// IsKeyword reports whether t is the token type of a keyword.
+func IsKeyword(t TokenType) bool {
+	_, ok := keywords.Load().literals[t]
+	return ok
+}
@@ -1,3 +1,5 @@
+// Package token defines the tokens of the lexer. Token types come and go
+// with the grammar; they are not part of the stable API in package monkey.
 package token
 
 type TokenType string
@@ -5,6 +7,9 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Offset  int // byte offset of the token's first character in the source
+	Line    int // 1-based line of the token's first character
+	Column  int // 1-based byte column of the token's first character
 }
 
 const (
@@ -12,6 +17,16 @@ const (
 	EOF     = "EOF"
 	IDENT   = "IDENT"
 	INT     = "INT"
+	FLOAT   = "FLOAT"
+	COMMENT = "COMMENT"
+	STRING  = "STRING"
+
+	// An interpolated string such as "a{x}b{y}c" is lexed as INTERP_START
+	// "a", the tokens of x, INTERP_MID "b", the tokens of y and INTERP_END
+	// "c", each literal holding a part of the string's text.
+	INTERP_START = "INTERP_START"
+	INTERP_MID   = "INTERP_MID"
+	INTERP_END   = "INTERP_END"
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -19,9 +34,17 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
 	LT       = "<"
 	GT       = ">"
 
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+
 	COMMA     = ","
 	SEMICOLON = ";"
 	LPAREN    = "("
@@ -39,21 +62,16 @@ const (
 
 	EQ     = "=="
 	NOT_EQ = "!="
-)
+	LT_EQ  = "<="
+	GT_EQ  = ">="
+	AND    = "&&"
+	OR     = "||"
 
-var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-}
+	INCREMENT = "++"
+	DECREMENT = "--"
 
-func LookupIdent(ident string) TokenType {
-	if tok, ok := keywords[ident]; ok {
-		return tok
-	}
-	return IDENT
-}
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
+)
@@ -0,0 +1,249 @@
+// Package transpile translates Monkey programs into Go source that runs
+// them ahead of time, without the tree-walking evaluator.
+//
+// The generated code keeps Monkey's environments, so bindings, closures
+// and shadowing behave exactly as in the evaluator, and it leaves every
+// operator, call and lookup to the runtime functions of package eval.
+// Monkey functions become Go closures wrapped by eval.Closure; they show up
+// as builtins named "fn" when inspected. Errors and return statements both
+// leave the Go function of the enclosing Monkey function or program, which
+// is how the evaluator propagates them too.
+package transpile
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"monkey/ast"
+	"strconv"
+)
+
+// Program returns the source of a Go command that runs program the way
+// `monkey run` does: it calls main if the program defines it, with the
+// command's arguments, which must be integers. It exits with main's result
+// if that is an integer, prints any other result but null and reports
+// errors, internal ones included, on standard error with exit status 1. It
+// has to be built inside the monkey module.
+func Program(program *ast.Program) ([]byte, error) {
+	g := &generator{}
+	g.printf("// Code generated by monkey transpile. DO NOT EDIT.\n\n")
+	g.printf("package main\n\n")
+	g.printf("import (\n\"context\"\n\"fmt\"\n\"monkey/eval\"\n\"monkey/object\"\n\"os\"\n\"strconv\"\n)\n\n")
+	g.printf(`func main() {
+	args := []object.Object{}
+	for _, arg := range os.Args[1:] {
+		n, err := strconv.ParseInt(arg, 0, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "argument %%q is not an integer\n", arg)
+			os.Exit(1)
+		}
+		args = append(args, &object.Integer{Value: n})
+	}
+
+	env := object.NewEnvironment()
+	result := eval.RunFunc(context.Background(), env, run, args...)
+	_, hasMain := env.Get(eval.MAIN)
+
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Message)
+		os.Exit(1)
+	}
+	if code, ok := result.(*object.Integer); ok && hasMain {
+		os.Exit(int(code.Value))
+	}
+	if result != eval.NULL {
+		fmt.Println(result.Inspect())
+	}
+}
+
+`)
+	if err := g.function("run", program); err != nil {
+		return nil, err
+	}
+	return format.Source(g.out.Bytes())
+}
+
+// Func returns the source of a Go function declaration called name that
+// evaluates program in the environment it is given and returns the result:
+//
+//	func name(ctx context.Context, env *object.Environment) object.Object
+//
+// The file it is added to must import context, monkey/eval and
+// monkey/object.
+func Func(name string, program *ast.Program) ([]byte, error) {
+	g := &generator{}
+	if err := g.function(name, program); err != nil {
+		return nil, err
+	}
+	return format.Source(g.out.Bytes())
+}
+
+// generator writes Go code. Expressions are evaluated into numbered
+// variables, one statement at a time, so that errors can end evaluation as
+// soon as they occur.
+type generator struct {
+	out  bytes.Buffer
+	vars int
+	err  error
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
+
+func (g *generator) newVar() string {
+	g.vars++
+	return "v" + strconv.Itoa(g.vars)
+}
+
+func (g *generator) function(name string, program *ast.Program) error {
+	g.printf("func %s(ctx context.Context, env *object.Environment) object.Object {\n", name)
+	g.body(program.Statements)
+	g.printf("}\n")
+	return g.err
+}
+
+// body emits the statements of a program or function and returns the
+// value of the last one.
+func (g *generator) body(stmts []ast.Statement) {
+	if value, ok := g.block(stmts); ok {
+		g.printf("return %s\n", value)
+	}
+}
+
+// block emits stmts and returns the Go expression holding their value, as
+// the evaluator defines it for a block. It reports false if the block ends
+// in a return statement, which leaves the Go function.
+func (g *generator) block(stmts []ast.Statement) (string, bool) {
+	value := "eval.NULL"
+	for _, stmt := range stmts {
+		if value != "eval.NULL" {
+			g.printf("_ = %s\n", value)
+		}
+		value = "eval.NULL"
+
+		switch stmt := stmt.(type) {
+		case *ast.ExpressionStatement:
+			value = g.expression(stmt.Expression)
+		case *ast.LetStatement:
+			if stmt == nil || stmt.Value == nil {
+				g.fail(stmt)
+				continue
+			}
+			g.let(stmt)
+		case *ast.ReturnStatement:
+			g.printf("return %s\n", g.expression(stmt.ReturnValue))
+			return "", false
+		default:
+			g.fail(stmt)
+		}
+	}
+	return value, true
+}
+
+func (g *generator) let(stmt *ast.LetStatement) {
+	value := g.expression(stmt.Value)
+
+	if stmt.Else != nil {
+		name := "(...)"
+		if stmt.Names == nil {
+			name = stmt.Name.Value
+		}
+		g.printf("if %s == eval.NULL {\n", value)
+		if _, ok := g.block(stmt.Else.Statements); ok {
+			g.printf("return &object.Error{Message: %q}\n", "else block of let "+name+" must return")
+		}
+		g.printf("}\n")
+	}
+
+	if stmt.Names != nil {
+		names := ""
+		for _, name := range stmt.Names {
+			names += strconv.Quote(name.Value) + ", "
+		}
+		g.printf("if err := eval.BindTuple(env, []string{%s}, %s); err != nil {\nreturn err\n}\n", names, value)
+		return
+	}
+	g.printf("env.Set(%q, %s)\n", stmt.Name.Value, value)
+}
+
+// expression emits the evaluation of e and returns the variable holding
+// its value. Whatever may fail is followed by a check that returns the
+// error.
+func (g *generator) expression(e ast.Expression) string {
+	v := g.newVar()
+
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		g.printf("var %s object.Object = &object.Integer{Value: %d}\n", v, e.Value)
+		return v
+	case *ast.Boolean:
+		g.printf("%s := eval.Bool(%t)\n", v, e.Value)
+		return v
+	case *ast.Identifier:
+		g.printf("%s := eval.Lookup(env, %q)\n", v, e.Value)
+	case *ast.PrefixExpression:
+		right := g.expression(e.Right)
+		g.printf("%s := eval.Prefix(%q, %s)\n", v, e.Operator, right)
+	case *ast.InfixExpression:
+		left := g.expression(e.Left)
+		right := g.expression(e.Right)
+		g.printf("%s := eval.Infix(%q, %s, %s)\n", v, e.Operator, left, right)
+	case *ast.IfExpression:
+		cond := g.expression(e.Condition)
+		g.printf("var %s object.Object = eval.NULL\n", v)
+		g.printf("if eval.Truthy(%s) {\n", cond)
+		g.branch(v, e.Consequence)
+		if e.Alternative != nil {
+			g.printf("} else {\n")
+			g.branch(v, e.Alternative)
+		}
+		g.printf("}\n")
+		return v
+	case *ast.FunctionLiteral:
+		params := ""
+		for _, p := range e.Parameters {
+			params += strconv.Quote(p.Value) + ", "
+		}
+		g.printf("var %s object.Object = eval.Closure([]string{%s}, env, func(ctx context.Context, env *object.Environment) object.Object {\n", v, params)
+		g.body(e.Body.Statements)
+		g.printf("})\n")
+		return v
+	case *ast.CallExpression:
+		fn := g.expression(e.Function)
+		g.printf("if err := eval.Callable(%s); err != nil {\nreturn err\n}\n", fn)
+		args := ""
+		for _, arg := range e.Arguments {
+			args += g.expression(arg) + ", "
+		}
+		g.printf("%s := eval.Apply(ctx, %s, []object.Object{%s})\n", v, fn, args)
+	case *ast.TupleLiteral:
+		elements := ""
+		for _, el := range e.Elements {
+			elements += g.expression(el) + ", "
+		}
+		g.printf("var %s object.Object = &object.Tuple{Elements: []object.Object{%s}}\n", v, elements)
+		return v
+	default:
+		g.fail(e)
+		return "eval.NULL"
+	}
+
+	g.printf("if %s.Type() == object.ERROR_OBJ {\nreturn %s\n}\n", v, v)
+	return v
+}
+
+// branch emits a branch of an if expression, which stores its value in v.
+func (g *generator) branch(v string, b *ast.BlockStatement) {
+	if value, ok := g.block(b.Statements); ok {
+		g.printf("%s = %s\n", v, value)
+	}
+}
+
+// fail records that node cannot be translated, which only happens for the
+// incomplete trees of programs with parse errors.
+func (g *generator) fail(node ast.Node) {
+	if g.err == nil {
+		g.err = fmt.Errorf("cannot translate incomplete %T", node)
+	}
+}
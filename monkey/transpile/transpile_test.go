@@ -0,0 +1,104 @@
+package transpile
+
+import (
+	"errors"
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProgram(t *testing.T) {
+	program := parser.New(lexer.New("let main = fn() { let (a, b) = fn() { return 1, 2; }(); a + b };")).ParseProgram()
+	src, err := Program(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"package main",
+		"func run(ctx context.Context, env *object.Environment) object.Object {",
+		`eval.BindTuple(env, []string{"a", "b"}, `,
+		`eval.Infix("+", `,
+		`env.Set("main", `,
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("output does not contain %q:\n%s", want, src)
+		}
+	}
+}
+
+// TestProgramRuns builds a translated program and checks that it treats
+// its arguments, results and errors the way `monkey run` does.
+func TestProgramRuns(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a Go program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	program := parser.New(lexer.New("let main = fn(a, b) { a / b };")).ParseProgram()
+	src, err := Program(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	goMod := "module transpiled\n\ngo 1.22.0\n\nrequire monkey v0.0.0\n\nreplace monkey => " + root + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	build := exec.Command(goTool, "build", "-o", "prog", ".")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building translated program: %v\n%s", err, out)
+	}
+
+	tests := []struct {
+		args   []string
+		status int
+		output string
+	}{
+		{[]string{"84", "0x2"}, 42, ""},
+		{[]string{"1", "0"}, 1, "division by zero\n"},
+		{[]string{"1"}, 1, "Expected 2 arguments. Got=1\n"},
+		{[]string{"1", "x"}, 1, "argument \"x\" is not an integer\n"},
+	}
+	for _, tt := range tests {
+		out, err := exec.Command(filepath.Join(dir, "prog"), tt.args...).CombinedOutput()
+		status := 0
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			status = exit.ExitCode()
+		} else if err != nil {
+			t.Fatalf("running translated program: %v", err)
+		}
+		if status != tt.status || string(out) != tt.output {
+			t.Errorf("args %v: expected status %d and %q. got %d and %q", tt.args, tt.status, tt.output, status, out)
+		}
+	}
+}
+
+func TestUntranslatable(t *testing.T) {
+	p := parser.New(lexer.New("let x = ;"))
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatal("expected parse errors")
+	}
+	if _, err := Func("f", program); err == nil {
+		t.Fatal("expected an error translating a broken program")
+	}
+}